@@ -0,0 +1,154 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings read from the environment
+type Config struct {
+	// RetentionDays maps an item type to the number of days it is kept in the
+	// search index. Types that are missing or set to 0 are kept forever.
+	RetentionDays map[string]int
+	// PageCacheDays is how long cached item pages are kept on disk
+	PageCacheDays int
+	// KeepFavorites exempts favorite items from pruning
+	KeepFavorites bool
+	// RetentionInterval is how often the pruning job runs; 0 disables it
+	RetentionInterval time.Duration
+	// RetentionBatchSize is how many items are deleted per index batch
+	RetentionBatchSize int
+	// SessionTTL is how long a login session lasts without activity
+	SessionTTL time.Duration
+	// SessionKey is the 32-byte key used to encrypt persisted sessions.
+	// Sessions are only kept in memory when it is empty.
+	SessionKey []byte
+	// APIBase, WebBase and SearchBase replace the Firebase API, the website
+	// and the Algolia API, for example with a local stand-in. Empty means the
+	// real services.
+	APIBase    string
+	WebBase    string
+	SearchBase string
+}
+
+// Load reads the configuration from GOHN_* environment variables, falling back to defaults
+func Load() (*Config, error) {
+	cfg := &Config{
+		RetentionDays:      map[string]int{"comment": 90},
+		PageCacheDays:      30,
+		KeepFavorites:      true,
+		RetentionInterval:  6 * time.Hour,
+		RetentionBatchSize: 500,
+		SessionTTL:         30 * 24 * time.Hour,
+	}
+
+	if v := os.Getenv("GOHN_RETENTION_DAYS"); v != "" {
+		days, err := parseRetentionDays(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOHN_RETENTION_DAYS: %v", err)
+		}
+		cfg.RetentionDays = days
+	}
+
+	if v := os.Getenv("GOHN_PAGE_CACHE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("invalid GOHN_PAGE_CACHE_DAYS: %q", v)
+		}
+		cfg.PageCacheDays = days
+	}
+
+	if v := os.Getenv("GOHN_KEEP_FAVORITES"); v != "" {
+		keep, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOHN_KEEP_FAVORITES: %q", v)
+		}
+		cfg.KeepFavorites = keep
+	}
+
+	if v := os.Getenv("GOHN_RETENTION_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid GOHN_RETENTION_INTERVAL: %q", v)
+		}
+		cfg.RetentionInterval = interval
+	}
+
+	if v := os.Getenv("GOHN_RETENTION_BATCH_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid GOHN_RETENTION_BATCH_SIZE: %q", v)
+		}
+		cfg.RetentionBatchSize = size
+	}
+
+	if v := os.Getenv("GOHN_SESSION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid GOHN_SESSION_TTL: %q", v)
+		}
+		cfg.SessionTTL = ttl
+	}
+
+	if v := os.Getenv("GOHN_SESSION_KEY"); v != "" {
+		key, err := parseKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOHN_SESSION_KEY: %v", err)
+		}
+		cfg.SessionKey = key
+	}
+
+	for name, base := range map[string]*string{
+		"GOHN_API_BASE":    &cfg.APIBase,
+		"GOHN_WEB_BASE":    &cfg.WebBase,
+		"GOHN_SEARCH_BASE": &cfg.SearchBase,
+	} {
+		if v := os.Getenv(name); v != "" {
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*base = strings.TrimSuffix(v, "/")
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseKey decodes a 32-byte key given as hex or base64
+func parseKey(v string) ([]byte, error) {
+	if key, err := hex.DecodeString(v); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(v); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("expected 32 bytes encoded as hex or base64")
+}
+
+// parseRetentionDays parses a list like "comment=90,story=0"
+func parseRetentionDays(v string) (map[string]int, error) {
+	days := make(map[string]int)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		itemType, n, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected type=days, got %q", part)
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid number of days for %s: %q", itemType, n)
+		}
+		days[strings.TrimSpace(itemType)] = d
+	}
+	return days, nil
+}
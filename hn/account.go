@@ -0,0 +1,516 @@
+package hn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tluyben/go-hn/scraper"
+)
+
+// Account is a Hacker News identity with its own cookie jar. Each browser
+// session gets its own Account, so logging in only affects that session.
+type Account struct {
+	client     *Client
+	httpClient *http.Client // Follows redirects, for reading pages
+	noRedirect *http.Client // Returns redirects, for form posts that answer with one
+	mu         sync.Mutex   // Serializes web actions, so each one sees its own page state
+	loggedIn   bool
+	username   string
+}
+
+// NewAccount creates a logged-out account that shares the client's connection pool
+func (c *Client) NewAccount() (*Account, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Account{
+		client: c,
+		httpClient: &http.Client{
+			Jar:       jar,
+			Timeout:   30 * time.Second,
+			Transport: c.httpClient.Transport,
+		},
+		noRedirect: &http.Client{
+			Jar:       jar,
+			Timeout:   30 * time.Second,
+			Transport: c.httpClient.Transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// ErrSessionExpired is returned when restored cookies no longer log in to Hacker News
+var ErrSessionExpired = errors.New("hacker news session has expired")
+
+// Cookies returns the account's Hacker News cookies so the session can be saved
+func (a *Account) Cookies() []*http.Cookie {
+	u, err := url.Parse(a.client.webBase)
+	if err != nil {
+		return nil
+	}
+	return a.httpClient.Jar.Cookies(u)
+}
+
+// RestoreAccount recreates a logged-in account from saved cookies and checks
+// that Hacker News still accepts them. It returns ErrSessionExpired if it
+// doesn't; other errors mean the check itself failed.
+func (c *Client) RestoreAccount(username string, cookies []*http.Cookie) (*Account, error) {
+	a, err := c.NewAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(c.webBase)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range cookies {
+		cookie.Path = "/"
+	}
+	a.httpClient.Jar.SetCookies(u, cookies)
+
+	// Probe a page that only shows the username to logged-in users
+	page, _, err := a.getPage("news")
+	if err != nil {
+		return nil, err
+	}
+	if !page.LoggedIn() || page.User != username {
+		return nil, ErrSessionExpired
+	}
+
+	a.loggedIn = true
+	a.username = username
+	return a, nil
+}
+
+// IsLoggedIn returns whether the account is currently logged in
+func (a *Account) IsLoggedIn() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.loggedIn
+}
+
+// Username returns the name the account is logged in as, or "" if it isn't
+func (a *Account) Username() string {
+	if a == nil {
+		return ""
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.username
+}
+
+// getPage fetches and parses an HN page, returning it with the URL it was
+// served from so relative links and form actions can be resolved
+func (a *Account) getPage(path string) (*scraper.Page, string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", a.client.webBase, path), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	page, err := scraper.Parse(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return page, resp.Request.URL.String(), nil
+}
+
+// post submits values to target without following the redirect HN answers
+// successful actions with. The response body is parsed when there is no
+// redirect, since it then usually explains what went wrong.
+func (a *Account) post(target string, values url.Values) (*http.Response, *scraper.Page, error) {
+	req, err := http.NewRequest("POST", target, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return a.send(req)
+}
+
+// send performs a request without following redirects, see post
+func (a *Account) send(req *http.Request) (*http.Response, *scraper.Page, error) {
+	resp, err := a.noRedirect.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusFound {
+		return resp, nil, nil
+	}
+
+	page, err := scraper.Parse(resp.Body)
+	if err != nil {
+		return resp, nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return resp, page, nil
+}
+
+// ErrRateLimited is returned when HN refuses an action because the account is acting too fast
+var ErrRateLimited = errors.New("hacker news is rate limiting this account")
+
+// pageError turns the message on a failed action's page into an error,
+// falling back to fallback when HN didn't say what went wrong
+func pageError(page *scraper.Page, fallback string) error {
+	if page == nil || page.Message == "" {
+		return errors.New(fallback)
+	}
+	if page.RateLimited {
+		return fmt.Errorf("%w: %s", ErrRateLimited, page.Message)
+	}
+	return errors.New(page.Message)
+}
+
+// Login logs in to Hacker News
+func (a *Account) Login(username, password string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	page, base, err := a.getPage("login")
+	if err != nil {
+		return err
+	}
+
+	// The login page also has a form for creating an account; it's the one
+	// with a "creating" field
+	var form *scraper.Form
+	for i := range page.Forms {
+		f := &page.Forms[i]
+		if f.Method == "post" && f.HasField("acct") && f.HasField("pw") && !f.HasField("creating") {
+			form = f
+			break
+		}
+	}
+	if form == nil {
+		return errors.New("login form not found")
+	}
+
+	target, err := form.URL(base)
+	if err != nil {
+		return err
+	}
+	data := form.Values()
+	data.Set("acct", username)
+	data.Set("pw", password)
+	if data.Get("goto") == "" {
+		data.Set("goto", "news")
+	}
+
+	// Follow the redirect, the page it leads to shows whether we're logged in
+	req, err := http.NewRequest("POST", target, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result, err := scraper.Parse(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to parse login response: %v", err)
+	}
+
+	if result.LoggedIn() {
+		a.loggedIn = true
+		a.username = username
+		if result.User != "" {
+			a.username = result.User
+		}
+		return nil
+	}
+
+	if strings.Contains(result.Message, "Bad login") {
+		return errors.New("login failed: bad username or password")
+	}
+	if result.Message != "" {
+		return fmt.Errorf("login failed: %v", pageError(result, ""))
+	}
+
+	return errors.New("login failed: unknown reason")
+}
+
+// Logout ends the account's session on Hacker News, so the saved cookie no
+// longer logs anyone in. The account is logged out locally either way.
+func (a *Account) Logout() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return nil
+	}
+	a.loggedIn = false
+	a.username = ""
+
+	// The logout link carries an auth token, so it has to come from a page
+	page, _, err := a.getPage("news")
+	if err != nil {
+		return err
+	}
+	if page.LogoutAuth == "" {
+		// HN has already ended the session
+		return nil
+	}
+
+	query := url.Values{"auth": {page.LogoutAuth}, "goto": {"news"}}
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/logout?%s", a.client.webBase, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, result, err := a.send(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusFound {
+		return pageError(result, "failed to log out")
+	}
+
+	return nil
+}
+
+// SubmitStatus is the outcome of a submission
+type SubmitStatus string
+
+const (
+	SubmitCreated     SubmitStatus = "created"
+	SubmitDuplicate   SubmitStatus = "duplicate"
+	SubmitRateLimited SubmitStatus = "rate-limited"
+	SubmitInvalid     SubmitStatus = "invalid"
+)
+
+// SubmitResult describes what Hacker News did with a submission
+type SubmitResult struct {
+	Status SubmitStatus
+	// ItemID is the new story when created, if it could be found, or the
+	// earlier story when the submission was a duplicate
+	ItemID int
+	// Message is HN's explanation when rate limited or invalid
+	Message string
+}
+
+// maxTitleLength is the longest title HN accepts
+const maxTitleLength = 80
+
+// SubmitStory submits a new story to Hacker News. A story needs a title and
+// can have a URL, text or both; without a URL it's a text post like Ask HN.
+// Rejections are reported in the result, errors mean HN couldn't be asked.
+func (a *Account) SubmitStory(title, urlStr, text string) (*SubmitResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return nil, errors.New("you must be logged in to submit a story")
+	}
+
+	// Catch the obvious mistakes without a round trip
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return &SubmitResult{Status: SubmitInvalid, Message: "Please enter a title."}, nil
+	}
+	if len([]rune(title)) > maxTitleLength {
+		return &SubmitResult{Status: SubmitInvalid, Message: "Please limit titles to 80 characters."}, nil
+	}
+
+	page, base, err := a.getPage("submit")
+	if err != nil {
+		return nil, err
+	}
+
+	form := page.FindForm("title", "url")
+	if form == nil {
+		if !page.LoggedIn() {
+			return nil, ErrSessionExpired
+		}
+		return nil, pageError(page, "submit form not found")
+	}
+
+	target, err := form.URL(base)
+	if err != nil {
+		return nil, err
+	}
+	data := form.Values()
+	data.Set("title", title)
+	data.Set("url", urlStr)
+	data.Set("text", text)
+
+	resp, result, err := a.post(target, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusFound {
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect after submitting: %v", err)
+		}
+
+		// HN sends dupes of a recent story to that story, and new stories to /newest
+		if location.Path == "item" || location.Path == "/item" {
+			if id, err := strconv.Atoi(location.Query().Get("id")); err == nil {
+				return &SubmitResult{Status: SubmitDuplicate, ItemID: id}, nil
+			}
+		}
+
+		return &SubmitResult{Status: SubmitCreated, ItemID: a.findSubmission(title)}, nil
+	}
+
+	if result != nil && result.Message != "" {
+		if result.RateLimited {
+			return &SubmitResult{Status: SubmitRateLimited, Message: result.Message}, nil
+		}
+		return &SubmitResult{Status: SubmitInvalid, Message: result.Message}, nil
+	}
+
+	return nil, errors.New("failed to submit story")
+}
+
+// findSubmission looks up the ID of a story the account just submitted, or
+// returns 0 if it can't be found
+func (a *Account) findSubmission(title string) int {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/submitted?id=%s", a.client.webBase, url.QueryEscape(a.username)), nil)
+	if err != nil {
+		return 0
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	stories, err := scraper.ParseStories(resp.Body, time.Now())
+	if err != nil {
+		return 0
+	}
+
+	// Newest first, so the first match is the one we just posted
+	for _, story := range stories {
+		if story.Title == title {
+			return story.ID
+		}
+	}
+	return 0
+}
+
+// Upvote upvotes an item
+func (a *Account) Upvote(itemID int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return errors.New("you must be logged in to upvote")
+	}
+
+	// Vote links carry a per-item auth token, so they have to come from the item page
+	page, base, err := a.getPage(fmt.Sprintf("item?id=%d", itemID))
+	if err != nil {
+		return err
+	}
+
+	vote := page.FindVote(itemID, "up")
+	if vote == nil {
+		if !page.LoggedIn() {
+			return ErrSessionExpired
+		}
+		return errors.New("upvote link not found or you may have already voted")
+	}
+
+	voteURL, err := vote.URL(base)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", voteURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, result, err := a.send(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		return pageError(result, "failed to upvote")
+	}
+
+	return nil
+}
+
+// Comment adds a comment to an item
+func (a *Account) Comment(itemID int, text string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return errors.New("you must be logged in to comment")
+	}
+
+	page, base, err := a.getPage(fmt.Sprintf("item?id=%d", itemID))
+	if err != nil {
+		return err
+	}
+
+	// Pick the reply form for this item, not just the first form on the page
+	var form *scraper.Form
+	for i := range page.Forms {
+		f := &page.Forms[i]
+		if f.Method == "post" && f.HasField("text") && f.Hidden.Get("parent") == strconv.Itoa(itemID) {
+			form = f
+			break
+		}
+	}
+	if form == nil {
+		if !page.LoggedIn() {
+			return ErrSessionExpired
+		}
+		return pageError(page, "comment form not found")
+	}
+
+	target, err := form.URL(base)
+	if err != nil {
+		return err
+	}
+	data := form.Values()
+	data.Set("text", text)
+
+	resp, result, err := a.post(target, data)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		return pageError(result, "failed to post comment")
+	}
+
+	return nil
+}
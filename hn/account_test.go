@@ -0,0 +1,37 @@
+package hn
+
+import "testing"
+
+func TestLogout(t *testing.T) {
+	s := newStandIn(t, nil, nil)
+	c := newTestClient(t, s)
+
+	a, err := c.NewAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.loggedIn = true
+	a.username = "alice"
+
+	s.setPage("news", `<html><body><a id="me" href="user?id=alice">alice</a>
+		<a id="logout" rel="nofollow" href="logout?auth=4f1c0ffee&amp;goto=news">logout</a></body></html>`)
+	s.setRedirect("logout?auth=4f1c0ffee&goto=news", "news")
+
+	if err := a.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.count("/web/logout"); got != 1 {
+		t.Errorf("logout requested %d times, want 1", got)
+	}
+	if a.IsLoggedIn() || a.Username() != "" {
+		t.Errorf("account still logged in as %q", a.Username())
+	}
+
+	// Logging out again doesn't go back to HN
+	if err := a.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.count("/web/logout"); got != 1 {
+		t.Errorf("logout requested %d times, want 1", got)
+	}
+}
@@ -0,0 +1,68 @@
+package hn
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold is the number of consecutive API failures that opens the circuit
+	breakerThreshold = 5
+	// breakerCooldown is how long the circuit stays open before a request is let through again
+	breakerCooldown = 30 * time.Second
+)
+
+// ErrAPIUnavailable is returned without making a request while the API circuit is open
+var ErrAPIUnavailable = errors.New("hacker news API is unavailable")
+
+// breaker is a circuit breaker for the Firebase API. After breakerThreshold
+// failures in a row it opens and requests fail fast, until a single trial
+// request after the cooldown succeeds.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // A trial request is in flight while half-open
+}
+
+// allow reports whether a request may be made
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// isOpen reports whether requests are currently failing fast
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= breakerThreshold && (time.Now().Before(b.openUntil) || b.trial)
+}
+
+// success closes the circuit
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// failure counts a failed request, opening the circuit at the threshold
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
@@ -0,0 +1,367 @@
+package hn
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"html/template"
+	"slices"
+	"time"
+
+	"github.com/tluyben/go-hn/render"
+	"github.com/tluyben/go-hn/types"
+)
+
+const (
+	// threadWorkers is how many comments of a thread are fetched at a time
+	threadWorkers = 16
+	// threadDeadline is how long building a thread may take. Whatever
+	// arrived by then is shown and the rest is loaded by the page.
+	threadDeadline = 10 * time.Second
+)
+
+// CommentNode is a comment in a thread together with its replies, which are
+// kept in the order HN lists them
+type CommentNode struct {
+	Item *types.Item `json:"item"`
+	// Depth is 0 for replies to the story, 1 for replies to those, and so on
+	Depth    int            `json:"depth"`
+	Children []*CommentNode `json:"children,omitempty"`
+	// DescendantCount is the number of comments below this one, which a
+	// collapsed comment shows in place of its replies
+	DescendantCount int `json:"descendant_count"`
+	// Incomplete is set when some of the replies below this comment could
+	// not be fetched in time
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Truncated is set on copies made by PruneThread whose replies were
+	// left out
+	Truncated bool `json:"-"`
+	// New is set by MarkNew on comments the user hasn't seen before
+	New bool `json:"-"`
+	// HTML is the comment's text rendered for the page, which is cached with
+	// the thread since highlighting code takes a while
+	HTML template.HTML `json:"html,omitempty"`
+}
+
+// Placeholder reports whether the comment was deleted or killed. Such
+// comments are only kept to hold the replies they got before.
+func (n *CommentNode) Placeholder() bool {
+	return n.Item.Dead || n.Item.Deleted
+}
+
+// newCommentNode creates a node for item, renders its text and counts the
+// comments below it. Placeholders don't count as comments themselves.
+func newCommentNode(item *types.Item, depth int, children []*CommentNode) *CommentNode {
+	node := &CommentNode{Item: item, Depth: depth, Children: children}
+	if item.Text != "" {
+		node.HTML = template.HTML(render.Text(item.Text))
+	}
+	for _, child := range children {
+		node.DescendantCount += child.DescendantCount
+		if !child.Placeholder() {
+			node.DescendantCount++
+		}
+	}
+	return node
+}
+
+// fetchThread fetches the replies to parent and everything below them,
+// giving up after threadDeadline. It reports whether every reply directly
+// below parent was fetched; deeper gaps are marked on the nodes they are in.
+//
+// If emit isn't nil it is called with each reply, in order, as soon as its
+// own thread is complete, so a page can be sent while the rest is fetched.
+func (c *Client) fetchThread(parent *types.Item, depth int, emit func(node *CommentNode)) ([]*CommentNode, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), threadDeadline)
+	defer cancel()
+
+	kids := parent.Kids
+	emitted := 0
+	emitUpTo := func(items map[int]*types.Item, end int) {
+		for ; emitted < end; emitted++ {
+			nodes, _ := buildThread(items, kids[emitted:emitted+1], depth)
+			for _, node := range nodes {
+				emit(node)
+			}
+		}
+	}
+
+	var finished func(items map[int]*types.Item, i int)
+	if emit != nil {
+		done := make([]bool, len(kids))
+		finished = func(items map[int]*types.Item, i int) {
+			done[i] = true
+			end := emitted
+			for end < len(kids) && done[end] {
+				end++
+			}
+			emitUpTo(items, end)
+		}
+	}
+
+	items := c.fetchTree(ctx, kids, finished)
+	if emit != nil {
+		// Whatever arrived of the threads that ran out of time
+		emitUpTo(items, len(kids))
+	}
+	return buildThread(items, kids, depth)
+}
+
+// fetchTree fetches the items with the given IDs and all their descendants,
+// threadWorkers at a time, and returns those that arrived before ctx is done.
+// The items with the given IDs come first, so when time runs out they are the
+// ones that made it, then the thread below the first ID before the one below
+// the second and so on, so threads complete in order. If finished isn't nil
+// it is called with the index of each ID whose thread is complete.
+func (c *Client) fetchTree(ctx context.Context, ids []int, finished func(items map[int]*types.Item, i int)) map[int]*types.Item {
+	type result struct {
+		id   int
+		item *types.Item
+	}
+	// Never more than threadWorkers are in flight, so workers that finish
+	// after the deadline don't block
+	results := make(chan result, threadWorkers)
+
+	items := make(map[int]*types.Item)
+	queue := &fetchQueue{}
+	threadOf := make(map[int]int)        // Index in ids of the thread an item belongs to
+	outstanding := make([]int, len(ids)) // Items of each thread not fetched yet
+	for i, id := range ids {
+		heap.Push(queue, fetchEntry{rank: -1, seq: i, id: id})
+		threadOf[id] = i
+		outstanding[i] = 1
+	}
+	seq := len(ids)
+
+	inFlight := 0
+	for queue.Len() > 0 || inFlight > 0 {
+		for inFlight < threadWorkers && queue.Len() > 0 {
+			entry := heap.Pop(queue).(fetchEntry)
+			inFlight++
+			go func(id int) {
+				item, err := c.GetItem(id)
+				if err != nil {
+					c.logger.Printf("Error fetching comment %d: %v", id, err)
+				}
+				results <- result{id: id, item: item}
+			}(entry.id)
+		}
+
+		select {
+		case r := <-results:
+			inFlight--
+			thread := threadOf[r.id]
+			outstanding[thread]--
+			if r.item != nil {
+				items[r.id] = r.item
+				for _, kidID := range r.item.Kids {
+					heap.Push(queue, fetchEntry{rank: thread, seq: seq, id: kidID})
+					seq++
+					threadOf[kidID] = thread
+					outstanding[thread]++
+				}
+			}
+			if outstanding[thread] == 0 && finished != nil {
+				finished(items, thread)
+			}
+		case <-ctx.Done():
+			return items
+		}
+	}
+
+	return items
+}
+
+// fetchEntry is an item waiting to be fetched by fetchTree
+type fetchEntry struct {
+	rank int // Index of the thread it belongs to, or -1 for the IDs themselves
+	seq  int // Order in which it was found
+	id   int
+}
+
+// fetchQueue is a heap of items to fetch, lowest rank first and within a rank
+// in the order they were found
+type fetchQueue []fetchEntry
+
+func (q fetchQueue) Len() int { return len(q) }
+
+func (q fetchQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q fetchQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *fetchQueue) Push(x any) { *q = append(*q, x.(fetchEntry)) }
+
+func (q *fetchQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// buildThread assembles the fetched items below kids into nodes, keeping
+// HN's order. Dead and deleted comments are left out unless they have
+// replies. It reports whether all of kids were fetched.
+func buildThread(items map[int]*types.Item, kids []int, depth int) ([]*CommentNode, bool) {
+	var nodes []*CommentNode
+	complete := true
+	for _, kidID := range kids {
+		item, ok := items[kidID]
+		if !ok {
+			complete = false
+			continue
+		}
+
+		children, childrenComplete := buildThread(items, item.Kids, depth+1)
+		node := newCommentNode(item, depth, children)
+		node.Incomplete = !childrenComplete
+		if node.Placeholder() && len(node.Children) == 0 && !node.Incomplete {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, complete
+}
+
+// GetReplies fetches the thread below an item, for loading a branch that
+// was incomplete when its page was built. depth is the depth of the replies
+// and the bool reports whether all of them were fetched.
+func (c *Client) GetReplies(itemID, depth int) ([]*CommentNode, bool, error) {
+	item, err := c.GetItem(itemID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	replies, complete := c.fetchThread(item, depth, nil)
+	return replies, complete, nil
+}
+
+// CommentContext is where a comment sits in its thread
+type CommentContext struct {
+	Root *types.Item
+	// Ancestors are the comments above it, from the top-level one down to
+	// its parent
+	Ancestors []*types.Item
+	// Parent is the last of the ancestors, or the root for a top-level comment
+	Parent *types.Item
+	// PrevSibling and NextSibling are the replies to the same parent listed
+	// before and after it, or 0 if there are none
+	PrevSibling int
+	NextSibling int
+}
+
+// GetCommentContext fetches the items above a comment and finds its siblings
+func (c *Client) GetCommentContext(item *types.Item) (*CommentContext, error) {
+	ancestors, err := c.GetAncestors(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(ancestors) == 0 {
+		return nil, fmt.Errorf("item %d has no parent", item.ID)
+	}
+
+	ctx := &CommentContext{
+		Root:      ancestors[0],
+		Ancestors: ancestors[1:],
+		Parent:    ancestors[len(ancestors)-1],
+	}
+	kids := ctx.Parent.Kids
+	if i := slices.Index(kids, item.ID); i >= 0 {
+		if i > 0 {
+			ctx.PrevSibling = kids[i-1]
+		}
+		if i < len(kids)-1 {
+			ctx.NextSibling = kids[i+1]
+		}
+	}
+	return ctx, nil
+}
+
+// PruneThread returns a copy of the thread cut off after the given number of
+// levels, so huge threads can be shown a part at a time
+func PruneThread(nodes []*CommentNode, levels int) []*CommentNode {
+	pruned := make([]*CommentNode, len(nodes))
+	for i, node := range nodes {
+		n := *node
+		if levels > 1 {
+			n.Children = PruneThread(node.Children, levels-1)
+		} else {
+			n.Children = nil
+			n.Truncated = len(node.Children) > 0
+		}
+		pruned[i] = &n
+	}
+	return pruned
+}
+
+// MarkNew sets New on the comments for which isNew returns true. Cached
+// threads are shared, so nodes must be copies such as PruneThread returns.
+func MarkNew(nodes []*CommentNode, isNew func(id int) bool) {
+	for _, node := range nodes {
+		node.New = !node.Placeholder() && isNew(node.Item.ID)
+		MarkNew(node.Children, isNew)
+	}
+}
+
+// CommentIDs returns the IDs of all comments in the thread
+func (p *ItemPage) CommentIDs() []int {
+	return ThreadIDs(p.Comments)
+}
+
+// ThreadIDs returns the IDs of the comments in nodes and their replies
+func ThreadIDs(nodes []*CommentNode) []int {
+	return appendCommentIDs(nil, nodes)
+}
+
+// appendCommentIDs appends the IDs of nodes and their replies to ids
+func appendCommentIDs(ids []int, nodes []*CommentNode) []int {
+	for _, node := range nodes {
+		ids = append(ids, node.Item.ID)
+		ids = appendCommentIDs(ids, node.Children)
+	}
+	return ids
+}
+
+// FindComment returns the comment with the given ID anywhere in the thread,
+// or nil if it isn't there
+func (p *ItemPage) FindComment(id int) *CommentNode {
+	return findComment(p.Comments, id)
+}
+
+// findComment searches nodes and their replies depth-first
+func findComment(nodes []*CommentNode, id int) *CommentNode {
+	for _, node := range nodes {
+		if node.Item.ID == id {
+			return node
+		}
+		if found := findComment(node.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// validThread reports whether every node carries an item. Pages cached
+// before comments were stored as a tree fail this check.
+func validThread(nodes []*CommentNode) bool {
+	for _, node := range nodes {
+		if node.Item == nil || !validThread(node.Children) {
+			return false
+		}
+	}
+	return true
+}
+
+// incompleteThread reports whether any branch of the thread is incomplete
+func incompleteThread(nodes []*CommentNode) bool {
+	for _, node := range nodes {
+		if node.Incomplete || incompleteThread(node.Children) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package hn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tluyben/go-hn/search"
+	"github.com/tluyben/go-hn/types"
+)
+
+// FindDiscussions returns earlier stories that link to the same article as urlStr,
+// newest first. Stories are matched on their canonical URL, using both the local
+// search index and Algolia. The story with ID excludeID is left out.
+func (c *Client) FindDiscussions(urlStr string, excludeID int) ([]types.Item, error) {
+	canonical := search.CanonicalURL(urlStr)
+	if canonical == "" {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	var discussions []types.Item
+
+	add := func(item types.Item) {
+		if item.ID == excludeID || seen[item.ID] || item.Type != "story" {
+			return
+		}
+		if search.CanonicalURL(item.URL) != canonical {
+			return
+		}
+		seen[item.ID] = true
+		discussions = append(discussions, item)
+	}
+
+	// Local index first: cheap and works offline
+	local, err := c.searchIndex.FindByCanonicalURL(canonical, 20)
+	if err != nil {
+		c.logger.Printf("Failed to search local index for %s: %v", canonical, err)
+	}
+	for _, si := range local {
+		add(searchableToItem(si))
+	}
+
+	// Then Algolia, which knows about stories we've never fetched
+	params := url.Values{}
+	params.Set("query", urlStr)
+	params.Set("restrictSearchableAttributes", "url")
+	params.Set("tags", "story")
+	params.Set("hitsPerPage", "20")
+	result, err := c.searchAlgolia("search", params)
+	if err != nil {
+		c.logger.Printf("Failed to search Algolia for %s: %v", urlStr, err)
+		if len(discussions) == 0 {
+			return nil, err
+		}
+	} else {
+		for _, hit := range result.Hits {
+			if item := algoliaHitToItem(hit); item != nil {
+				add(*item)
+			}
+		}
+	}
+
+	sort.Slice(discussions, func(i, j int) bool {
+		return discussions[i].Time > discussions[j].Time
+	})
+
+	return discussions, nil
+}
+
+// discussionsMaxAge is how long GetDiscussions keeps what it looked up
+const discussionsMaxAge = time.Hour
+
+// cachedDiscussions is what GetDiscussions keeps in the cache directory
+type cachedDiscussions struct {
+	Discussions []types.Item `json:"discussions"`
+	CachedAt    time.Time    `json:"cached_at"`
+}
+
+// GetDiscussions returns the earlier discussions of a story's URL, from its
+// cached page when that has them. Streamed pages are built without them, so
+// what is looked up here is cached separately.
+func (c *Client) GetDiscussions(itemID int) ([]types.Item, error) {
+	if page, err := c.loadItemPageFromCache(itemID); err == nil && len(page.Discussions) > 0 {
+		return page.Discussions, nil
+	}
+
+	cacheFile := fmt.Sprintf("./cache/discussions_%d.json", itemID)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		var cached cachedDiscussions
+		if err := json.Unmarshal(data, &cached); err == nil && time.Since(cached.CachedAt) < discussionsMaxAge {
+			return cached.Discussions, nil
+		}
+	}
+
+	item, err := c.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type != "story" || item.URL == "" {
+		return nil, nil
+	}
+	discussions, err := c.FindDiscussions(item.URL, item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll("./cache", 0755); err != nil {
+		c.logger.Printf("Failed to create cache directory: %v", err)
+	} else if data, err := json.Marshal(cachedDiscussions{Discussions: discussions, CachedAt: time.Now()}); err == nil {
+		if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+			c.logger.Printf("Failed to write discussions cache: %v", err)
+		}
+	}
+
+	return discussions, nil
+}
+
+// searchAlgolia runs a query against one of the Algolia search endpoints
+func (c *Client) searchAlgolia(endpoint string, params url.Values) (*SearchResult, error) {
+	url := fmt.Sprintf("%s/%s?%s", c.searchBase, endpoint, params.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result SearchResult
+	err = c.doRequest(req, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// algoliaHitToItem converts an Algolia search hit to an Item, or returns nil if the hit has no usable ID
+func algoliaHitToItem(hit map[string]interface{}) *types.Item {
+	objectID, _ := hit["objectID"].(string)
+	id, err := strconv.Atoi(objectID)
+	if err != nil {
+		return nil
+	}
+
+	item := &types.Item{
+		ID:   id,
+		Type: "story",
+	}
+	if tags, ok := hit["_tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			switch tag {
+			case "comment", "job", "poll", "pollopt":
+				item.Type = tag.(string)
+			}
+		}
+	}
+	item.By, _ = hit["author"].(string)
+	item.Title, _ = hit["title"].(string)
+	item.URL, _ = hit["url"].(string)
+	if text, ok := hit["story_text"].(string); ok {
+		item.Text = text
+	} else if text, ok := hit["comment_text"].(string); ok {
+		item.Text = text
+	}
+	if points, ok := hit["points"].(float64); ok {
+		item.Score = int(points)
+	}
+	if comments, ok := hit["num_comments"].(float64); ok {
+		item.Descendants = int(comments)
+	}
+	if created, ok := hit["created_at_i"].(float64); ok {
+		item.Time = int(created)
+	}
+	if parent, ok := hit["parent_id"].(float64); ok {
+		item.Parent = int(parent)
+	}
+
+	return item
+}
@@ -0,0 +1,315 @@
+package hn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tluyben/go-hn/search"
+	"github.com/tluyben/go-hn/types"
+)
+
+// siteRe matches the domain names accepted by GetDomainPage
+var siteRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// PosterCount is the number of stories a user has submitted from a domain
+type PosterCount struct {
+	By      string `json:"by"`
+	Stories int    `json:"stories"`
+}
+
+// DomainStats holds aggregate numbers for the stories submitted from a domain
+type DomainStats struct {
+	TotalStories  int           `json:"total_stories"`
+	AveragePoints int           `json:"average_points"`
+	TopPosters    []PosterCount `json:"top_posters"`
+	CachedAt      time.Time     `json:"cached_at"`
+}
+
+// DomainPage is one page of the stories submitted from a domain
+type DomainPage struct {
+	Site    string
+	Stories []types.Item
+	Stats   *DomainStats
+	HasMore bool
+	// Next is where the next page starts
+	Next DomainCursor
+}
+
+// DomainCursor marks where a page of a domain's stories ended: the time and
+// ID of its last story. The zero cursor starts at the newest story.
+type DomainCursor struct {
+	Time int
+	ID   int
+}
+
+// ParseDomainCursor parses a cursor formatted by String
+func ParseDomainCursor(s string) (DomainCursor, error) {
+	timeStr, idStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return DomainCursor{}, fmt.Errorf("invalid cursor: %q", s)
+	}
+	t, err := strconv.Atoi(timeStr)
+	if err != nil || t <= 0 {
+		return DomainCursor{}, fmt.Errorf("invalid cursor: %q", s)
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		return DomainCursor{}, fmt.Errorf("invalid cursor: %q", s)
+	}
+	return DomainCursor{Time: t, ID: id}, nil
+}
+
+// String formats the cursor for the next page's URL
+func (c DomainCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.Time, c.ID)
+}
+
+// IsZero reports whether the cursor starts at the newest story
+func (c DomainCursor) IsZero() bool {
+	return c.Time == 0
+}
+
+// precedes reports whether item comes after the cursor, newest first
+func (c DomainCursor) precedes(item types.Item) bool {
+	return c.IsZero() || item.Time < c.Time || (item.Time == c.Time && item.ID < c.ID)
+}
+
+// GetDomainPage lists stories linking to site, newest first, starting after
+// cursor. It merges the local search index with Algolia by time, so whatever
+// doesn't fit on this page is where the next one starts. page only numbers
+// the stories.
+func (c *Client) GetDomainPage(site string, cursor DomainCursor, page, perPage int) (*DomainPage, error) {
+	site = search.Domain("https://" + strings.TrimSpace(site))
+	if !siteRe.MatchString(site) {
+		return nil, fmt.Errorf("invalid site: %q", site)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 30
+	}
+
+	seen := make(map[int]bool)
+	var stories []types.Item
+	hasMore := false
+
+	add := func(item types.Item) {
+		if seen[item.ID] || item.Type != "story" || !matchesSite(item.URL, site) || !cursor.precedes(item) {
+			return
+		}
+		seen[item.ID] = true
+		stories = append(stories, item)
+	}
+
+	// Local index. Each source contributes up to a page, and one more story
+	// tells whether there is a next page.
+	local, total, err := c.searchIndex.FindByDomain(site, cursor.Time, cursor.ID, perPage+1)
+	if err != nil {
+		c.logger.Printf("Failed to search local index for %s: %v", site, err)
+	}
+	for _, si := range local {
+		add(searchableToItem(si))
+	}
+	if total > uint64(len(local)) {
+		hasMore = true
+	}
+
+	// Algolia, which can't filter on IDs, so stories posted in the same
+	// second as the cursor are skipped by add
+	params := url.Values{}
+	params.Set("query", site)
+	params.Set("restrictSearchableAttributes", "url")
+	params.Set("tags", "story")
+	params.Set("hitsPerPage", strconv.Itoa(perPage+1))
+	if !cursor.IsZero() {
+		params.Set("numericFilters", fmt.Sprintf("created_at_i<=%d", cursor.Time))
+	}
+	result, err := c.searchAlgolia("search_by_date", params)
+	if err != nil {
+		c.logger.Printf("Failed to search Algolia for %s: %v", site, err)
+		if len(stories) == 0 {
+			return nil, err
+		}
+	} else {
+		for _, hit := range result.Hits {
+			if item := algoliaHitToItem(hit); item != nil {
+				add(*item)
+			}
+		}
+		if result.NbHits > len(result.Hits) {
+			hasMore = true
+		}
+	}
+
+	sort.Slice(stories, func(i, j int) bool {
+		if stories[i].Time != stories[j].Time {
+			return stories[i].Time > stories[j].Time
+		}
+		return stories[i].ID > stories[j].ID
+	})
+	if len(stories) > perPage {
+		stories = stories[:perPage]
+		hasMore = true
+	}
+	for i := range stories {
+		stories[i].Rank = (page-1)*perPage + i + 1
+	}
+
+	var next DomainCursor
+	if len(stories) > 0 {
+		last := stories[len(stories)-1]
+		next = DomainCursor{Time: last.Time, ID: last.ID}
+	} else {
+		hasMore = false
+	}
+
+	stats, err := c.getDomainStats(site)
+	if err != nil {
+		c.logger.Printf("Failed to compute stats for %s: %v", site, err)
+	}
+
+	return &DomainPage{
+		Site:    site,
+		Stories: stories,
+		Stats:   stats,
+		HasMore: hasMore,
+		Next:    next,
+	}, nil
+}
+
+// getDomainStats computes aggregate numbers for a domain, cached for an hour
+func (c *Client) getDomainStats(site string) (*DomainStats, error) {
+	if err := os.MkdirAll("./cache", 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	cacheFile := fmt.Sprintf("./cache/domain_%s.json", site)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		var stats DomainStats
+		if err := json.Unmarshal(data, &stats); err == nil && time.Since(stats.CachedAt) < time.Hour {
+			return &stats, nil
+		}
+	}
+
+	seen := make(map[int]bool)
+	var stories []types.Item
+	add := func(item types.Item) {
+		if seen[item.ID] || item.Type != "story" || !matchesSite(item.URL, site) {
+			return
+		}
+		seen[item.ID] = true
+		stories = append(stories, item)
+	}
+
+	local, localTotal, err := c.searchIndex.FindByDomain(site, 0, 0, 1000)
+	if err != nil {
+		c.logger.Printf("Failed to search local index for %s: %v", site, err)
+	}
+	for _, si := range local {
+		add(searchableToItem(si))
+	}
+
+	params := url.Values{}
+	params.Set("query", site)
+	params.Set("restrictSearchableAttributes", "url")
+	params.Set("tags", "story")
+	params.Set("hitsPerPage", "1000")
+	params.Set("attributesToRetrieve", "author,points,url,created_at_i,num_comments,title")
+	params.Set("attributesToHighlight", "")
+	algoliaTotal := 0
+	result, err := c.searchAlgolia("search", params)
+	if err != nil {
+		c.logger.Printf("Failed to search Algolia for %s: %v", site, err)
+	} else {
+		algoliaTotal = result.NbHits
+		for _, hit := range result.Hits {
+			if item := algoliaHitToItem(hit); item != nil {
+				add(*item)
+			}
+		}
+	}
+
+	if len(stories) == 0 && err != nil {
+		return nil, err
+	}
+
+	stats := &DomainStats{CachedAt: time.Now()}
+
+	// Algolia's hit count covers stories beyond the sample we fetched
+	stats.TotalStories = len(stories)
+	if algoliaTotal > stats.TotalStories {
+		stats.TotalStories = algoliaTotal
+	}
+	if int(localTotal) > stats.TotalStories {
+		stats.TotalStories = int(localTotal)
+	}
+
+	points := 0
+	posters := make(map[string]int)
+	for _, story := range stories {
+		points += story.Score
+		if story.By != "" {
+			posters[story.By]++
+		}
+	}
+	if len(stories) > 0 {
+		stats.AveragePoints = points / len(stories)
+	}
+
+	for by, count := range posters {
+		stats.TopPosters = append(stats.TopPosters, PosterCount{By: by, Stories: count})
+	}
+	sort.Slice(stats.TopPosters, func(i, j int) bool {
+		if stats.TopPosters[i].Stories != stats.TopPosters[j].Stories {
+			return stats.TopPosters[i].Stories > stats.TopPosters[j].Stories
+		}
+		return stats.TopPosters[i].By < stats.TopPosters[j].By
+	})
+	if len(stats.TopPosters) > 10 {
+		stats.TopPosters = stats.TopPosters[:10]
+	}
+
+	data, err := json.Marshal(stats)
+	if err == nil {
+		if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+			c.logger.Printf("Failed to write domain stats cache: %v", err)
+		}
+	}
+
+	return stats, nil
+}
+
+// matchesSite reports whether urlStr points at site or one of its subdomains.
+// Algolia matches URL words rather than hosts, so its hits need this check.
+func matchesSite(urlStr, site string) bool {
+	domain := search.Domain(urlStr)
+	return domain == site || strings.HasSuffix(domain, "."+site)
+}
+
+// searchableToItem converts a SearchableItem from the index back to an Item
+func searchableToItem(si *search.SearchableItem) types.Item {
+	return types.Item{
+		ID:          si.ID,
+		Type:        si.Type,
+		By:          si.By,
+		Time:        si.Time,
+		Text:        si.Text,
+		Parent:      si.Parent,
+		URL:         si.URL,
+		Score:       si.Score,
+		Title:       si.Title,
+		Descendants: si.Descendants,
+		Rank:        si.Rank,
+		Kids:        si.Kids,
+		Dead:        si.Dead,
+		Deleted:     si.Deleted,
+	}
+}
@@ -0,0 +1,153 @@
+package hn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tluyben/go-hn/scraper"
+)
+
+// EditWindow is how long after posting HN lets users edit or delete an item
+const EditWindow = 2 * time.Hour
+
+// EditOptions reports whether HN currently offers edit and delete links for
+// the item. They only appear on the user's own items, within EditWindow and
+// while nobody has replied.
+func (a *Account) EditOptions(itemID int) (canEdit, canDelete bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return false, false, nil
+	}
+
+	page, _, err := a.getPage(fmt.Sprintf("item?id=%d", itemID))
+	if err != nil {
+		return false, false, err
+	}
+
+	return page.CanEdit(itemID), page.CanDelete(itemID), nil
+}
+
+// EditText returns the item's text as it appears in HN's edit form, which is
+// the markup the user typed rather than the rendered HTML
+func (a *Account) EditText(itemID int) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	form, _, err := a.itemForm("edit", itemID)
+	if err != nil {
+		return "", err
+	}
+	return form.Fields.Get("text"), nil
+}
+
+// Edit replaces the text of one of the user's items. A story keeps its title.
+func (a *Account) Edit(itemID int, text string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return errors.New("you must be logged in to edit")
+	}
+
+	form, base, err := a.itemForm("edit", itemID)
+	if err != nil {
+		return err
+	}
+
+	target, err := form.URL(base)
+	if err != nil {
+		return err
+	}
+	data := form.Values()
+	data.Set("text", text)
+
+	resp, result, err := a.post(target, data)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		return pageError(result, "failed to edit item")
+	}
+
+	return nil
+}
+
+// Delete deletes one of the user's items
+func (a *Account) Delete(itemID int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return errors.New("you must be logged in to delete")
+	}
+
+	form, base, err := a.itemForm("delete-confirm", itemID)
+	if err != nil {
+		return err
+	}
+
+	target, err := form.URL(base)
+	if err != nil {
+		return err
+	}
+	data := form.Values()
+	// The confirmation page asks yes or no with two submit buttons named d
+	data.Set("d", "Yes")
+
+	resp, result, err := a.post(target, data)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		return pageError(result, "failed to delete item")
+	}
+
+	return nil
+}
+
+// itemForm fetches one of HN's per-item pages, such as edit or delete-confirm,
+// and returns its form for the item
+func (a *Account) itemForm(path string, itemID int) (*scraper.Form, string, error) {
+	page, base, err := a.getPage(fmt.Sprintf("%s?id=%d", path, itemID))
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range page.Forms {
+		f := &page.Forms[i]
+		if f.Method == "post" && f.Hidden.Get("id") == strconv.Itoa(itemID) {
+			return f, base, nil
+		}
+	}
+
+	if !page.LoggedIn() {
+		return nil, "", ErrSessionExpired
+	}
+	// HN explains why, for example when the edit window has closed
+	return nil, "", pageError(page, fmt.Sprintf("item %d can no longer be changed", itemID))
+}
+
+// RefreshItem refetches an item after it was changed and rebuilds the cached
+// page of the story it belongs to
+func (c *Client) RefreshItem(itemID int) (*ItemPage, error) {
+	// Fetching from the API queues the new version for the index, where
+	// GetItem finds it before the old one
+	item, err := c.fetchItemFromAPI(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := c.GetRootParent(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetItemPage(root.ID, true)
+}
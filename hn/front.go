@@ -0,0 +1,153 @@
+package hn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tluyben/go-hn/types"
+)
+
+// DayFormat is the layout of the day parameter of past front pages
+const DayFormat = "2006-01-02"
+
+// frontPageSize is the number of stories on a front page
+const frontPageSize = 30
+
+// FrontPage is the front page of a past day
+type FrontPage struct {
+	Day     string       `json:"day"`
+	Stories []types.Item `json:"stories"`
+	// Source is "front" when the page was read from the website and "algolia"
+	// when it was rebuilt from the day's highest scoring stories
+	Source   string    `json:"source"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// algoliaFrontPageMaxAge is how long a front page rebuilt from Algolia is
+// cached before the website is tried again
+const algoliaFrontPageMaxAge = time.Hour
+
+// GetFrontPage returns the front page of day (UTC). Days that are over never
+// change, so their pages are cached permanently once read from the website.
+// The approximation from Algolia that stands in when the website fails is
+// only cached for algoliaFrontPageMaxAge.
+func (c *Client) GetFrontPage(day time.Time) (*FrontPage, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	if start.After(time.Now()) {
+		return nil, fmt.Errorf("day %s is in the future", start.Format(DayFormat))
+	}
+	finished := !end.After(time.Now())
+
+	cacheFile := fmt.Sprintf("./cache/front_%s.json", start.Format(DayFormat))
+	var stale *FrontPage
+	if finished {
+		cached, err := loadFrontPage(cacheFile)
+		if err == nil && (cached.Source == "front" || time.Since(cached.CachedAt) < algoliaFrontPageMaxAge) {
+			return cached, nil
+		}
+		stale = cached
+	}
+
+	page := &FrontPage{
+		Day:      start.Format(DayFormat),
+		Source:   "front",
+		CachedAt: time.Now(),
+	}
+
+	// The website's own front page has the real ranking
+	stories, err := c.scrapeStoryList("front?day=" + page.Day)
+	if err != nil || len(stories) == 0 {
+		if err != nil {
+			c.logger.Printf("Failed to scrape front page for %s: %v", page.Day, err)
+		}
+
+		stories, err = c.algoliaFrontPage(start, end)
+		if err != nil {
+			if stale != nil {
+				return stale, nil
+			}
+			return nil, fmt.Errorf("failed to fetch front page for %s: %v", page.Day, err)
+		}
+		page.Source = "algolia"
+	}
+	page.Stories = stories
+
+	if finished && len(stories) > 0 {
+		if err := writeFrontPage(cacheFile, page); err != nil {
+			c.logger.Printf("Failed to cache front page for %s: %v", page.Day, err)
+		}
+	}
+
+	return page, nil
+}
+
+// algoliaFrontPage approximates a front page with the highest scoring stories
+// submitted between start and end
+func (c *Client) algoliaFrontPage(start, end time.Time) ([]types.Item, error) {
+	params := url.Values{}
+	params.Set("tags", "story")
+	params.Set("numericFilters", fmt.Sprintf("created_at_i>=%d,created_at_i<%d", start.Unix(), end.Unix()))
+	params.Set("hitsPerPage", strconv.Itoa(frontPageSize))
+	params.Set("attributesToHighlight", "")
+
+	// Without a query, the search endpoint ranks by points
+	result, err := c.searchAlgolia("search", params)
+	if err != nil {
+		return nil, err
+	}
+
+	stories := make([]types.Item, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		if item := algoliaHitToItem(hit); item != nil && item.Type == "story" {
+			stories = append(stories, *item)
+		}
+	}
+
+	sort.SliceStable(stories, func(i, j int) bool {
+		return stories[i].Score > stories[j].Score
+	})
+	for i := range stories {
+		stories[i].Rank = i + 1
+	}
+
+	return stories, nil
+}
+
+// loadFrontPage reads a cached front page
+func loadFrontPage(cacheFile string) (*FrontPage, error) {
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var page FrontPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache file: %v", err)
+	}
+
+	return &page, nil
+}
+
+// writeFrontPage caches a front page
+func writeFrontPage(cacheFile string, page *FrontPage) error {
+	if err := os.MkdirAll("./cache", 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to marshal front page: %v", err)
+	}
+
+	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+
+	return nil
+}
@@ -3,17 +3,15 @@ package hn
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tluyben/go-hn/search"
@@ -45,9 +43,6 @@ type Client struct {
 	apiBase     string
 	webBase     string
 	searchBase  string
-	loggedIn    bool
-	username    string
-	csrf        string
 	cache       map[int]*types.Item
 	logger      *log.Logger
 	semaphore   chan struct{} // Semaphore for limiting concurrent requests
@@ -55,15 +50,13 @@ type Client struct {
 	storyTypes  []string      // List of story types to rotate through
 	currentIdx  int           // Current index in storyTypes
 	searchIndex *search.Index
+	apiBreaker  *breaker // Trips when the Firebase API keeps failing
+	refreshMu   sync.Mutex
+	refreshing  map[int]bool // Item pages being rebuilt from the API in the background
 }
 
 // NewClient creates a new Hacker News client
 func NewClient() (*Client, error) {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, err
-	}
-
 	// Create a custom transport with connection pooling
 	transport := &http.Transport{
 		MaxIdleConns:        50, // Reduced from 100
@@ -86,14 +79,12 @@ func NewClient() (*Client, error) {
 
 	return &Client{
 		httpClient: &http.Client{
-			Jar:       jar,
 			Timeout:   30 * time.Second,
 			Transport: transport,
 		},
 		apiBase:     "https://hacker-news.firebaseio.com/v0",
 		webBase:     "https://news.ycombinator.com",
 		searchBase:  "https://hn.algolia.com/api/v1",
-		loggedIn:    false,
 		cache:       make(map[int]*types.Item),
 		logger:      logger,
 		semaphore:   make(chan struct{}, 3), // Limit to 3 concurrent requests
@@ -101,32 +92,34 @@ func NewClient() (*Client, error) {
 		storyTypes:  []string{"topstories", "newstories", "beststories", "askstories", "showstories", "jobstories"},
 		currentIdx:  0,
 		searchIndex: searchIndex,
+		apiBreaker:  &breaker{},
+		refreshing:  make(map[int]bool),
 	}, nil
 }
 
+// SetBaseURLs points the client at other hosts for the Firebase API, the
+// website and the Algolia API. Empty values keep the current ones.
+func (c *Client) SetBaseURLs(apiBase, webBase, searchBase string) {
+	if apiBase != "" {
+		c.apiBase = apiBase
+	}
+	if webBase != "" {
+		c.webBase = webBase
+	}
+	if searchBase != "" {
+		c.searchBase = searchBase
+	}
+}
+
 // GetItem fetches an item by ID, using search index if available
 func (c *Client) GetItem(id int) (*types.Item, error) {
-	// Try to get from search index first
+	// Try to get from search index first, unless it only has Algolia's copy
 	searchableItem, err := c.searchIndex.GetItem(id)
-	if err == nil {
+	if err == nil && !searchableItem.Approximate {
 		fmt.Println("Search Engine hit for item ", id)
 		// Convert SearchableItem back to hn.Item
-		item := &types.Item{
-			ID:          searchableItem.ID,
-			Type:        searchableItem.Type,
-			By:          searchableItem.By,
-			Time:        searchableItem.Time,
-			Text:        searchableItem.Text,
-			Parent:      searchableItem.Parent,
-			URL:         searchableItem.URL,
-			Score:       searchableItem.Score,
-			Title:       searchableItem.Title,
-			Descendants: searchableItem.Descendants,
-			Rank:        searchableItem.Rank,
-			VoteDir:     searchableItem.VoteDir,
-			Kids:        searchableItem.Kids,
-		}
-		return item, nil
+		item := searchableToItem(searchableItem)
+		return &item, nil
 	}
 
 	return c.fetchItemFromAPI(id)
@@ -147,8 +140,8 @@ func (c *Client) fetchItemFromAPI(id int) (*types.Item, error) {
 		return nil, err
 	}
 
-	// Index the item for future use
-	if err := c.searchIndex.IndexItem(&item); err != nil {
+	// Queue the item for indexing; it is written with the next batch
+	if err := c.searchIndex.Enqueue(&item); err != nil {
 		c.logger.Printf("Failed to index item %d: %v", id, err)
 	}
 
@@ -323,286 +316,6 @@ func (c *Client) Search(query string) (*SearchResult, error) {
 	return &result, nil
 }
 
-// Login logs in to Hacker News
-func (c *Client) Login(username, password string) error {
-	loginURL := fmt.Sprintf("%s/login", c.webBase)
-
-	// First, get the login page to extract any potential CSRF token
-	req, err := http.NewRequest("GET", loginURL, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	// Extract CSRF token if present - HN doesn't use CSRF tokens for login,
-	// but we'll keep this code in case they add it in the future
-	csrfRe := regexp.MustCompile(`name="csrf" value="([^"]+)"`)
-	csrfMatches := csrfRe.FindSubmatch(body)
-	if len(csrfMatches) > 1 {
-		c.csrf = string(csrfMatches[1])
-	}
-
-	// Now perform the login
-	data := make(url.Values)
-	data.Set("acct", username)
-	data.Set("pw", password)
-	if c.csrf != "" {
-		data.Set("csrf", c.csrf)
-	}
-	data.Set("goto", "news")
-
-	req, err = http.NewRequest("POST", loginURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err = c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// Check if login was successful by looking for a user-specific element
-	body, err = io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	// If we find "Bad login", login failed
-	if strings.Contains(string(body), "Bad login") {
-		return errors.New("login failed: bad username or password")
-	}
-
-	// If we find a logout link or the username, login succeeded
-	if strings.Contains(string(body), fmt.Sprintf("user?id=%s", username)) ||
-		strings.Contains(string(body), ">logout<") {
-		c.loggedIn = true
-		c.username = username
-		return nil
-	}
-
-	return errors.New("login failed: unknown reason")
-}
-
-// SubmitStory submits a new story to Hacker News
-func (c *Client) SubmitStory(title, urlStr string) (int, error) {
-	if !c.loggedIn {
-		return 0, errors.New("you must be logged in to submit a story")
-	}
-
-	// Get the submit page to extract any potential CSRF token
-	submitURL := fmt.Sprintf("%s/submit", c.webBase)
-	req, err := http.NewRequest("GET", submitURL, nil)
-	if err != nil {
-		return 0, err
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
-	}
-
-	// Extract CSRF token if present
-	csrfRe := regexp.MustCompile(`name="csrf" value="([^"]+)"`)
-	csrfMatches := csrfRe.FindSubmatch(body)
-	if len(csrfMatches) > 1 {
-		c.csrf = string(csrfMatches[1])
-	}
-
-	// Now submit the story
-	formData := make(url.Values)
-	formData.Set("title", title)
-	formData.Set("url", urlStr)
-	if c.csrf != "" {
-		formData.Set("csrf", c.csrf)
-	}
-
-	var submitReq *http.Request
-	submitReq, err = http.NewRequest("POST", submitURL, strings.NewReader(formData.Encode()))
-	if err != nil {
-		return 0, err
-	}
-
-	submitReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err = c.httpClient.Do(submitReq)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	// Check if the submission was successful and get the new item ID
-	if resp.StatusCode == http.StatusFound {
-		// Get the redirect URL which should contain the item ID
-		if location := resp.Header.Get("Location"); location != "" {
-			re := regexp.MustCompile(`item\?id=(\d+)`)
-			matches := re.FindStringSubmatch(location)
-			if len(matches) > 1 {
-				id, err := strconv.Atoi(matches[1])
-				if err != nil {
-					return 0, err
-				}
-				return id, nil
-			}
-		}
-	}
-
-	return 0, errors.New("failed to submit story")
-}
-
-// Upvote upvotes an item
-func (c *Client) Upvote(itemID int) error {
-	if !c.loggedIn {
-		return errors.New("you must be logged in to upvote")
-	}
-
-	// First, visit the item page to extract any potential CSRF token
-	itemURL := fmt.Sprintf("%s/item?id=%d", c.webBase, itemID)
-	req, err := http.NewRequest("GET", itemURL, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	// Check if there's an upvote link
-	upvoteRe := regexp.MustCompile(fmt.Sprintf(`href="vote\?id=(%d)&amp;how=up&amp;goto=`, itemID))
-	upvoteMatches := upvoteRe.FindSubmatch(body)
-	if len(upvoteMatches) < 2 {
-		return errors.New("upvote link not found or you may have already voted")
-	}
-
-	// Extract auth parameter
-	authRe := regexp.MustCompile(fmt.Sprintf(`href="vote\?id=%d&amp;how=up&amp;goto=.+&amp;auth=([^"]+)"`, itemID))
-	authMatches := authRe.FindSubmatch(body)
-	if len(authMatches) < 2 {
-		return errors.New("auth parameter not found")
-	}
-	auth := string(authMatches[1])
-
-	// Now upvote the item
-	voteURL := fmt.Sprintf("%s/vote", c.webBase)
-	data := make(url.Values)
-	data.Set("id", strconv.Itoa(itemID))
-	data.Set("how", "up")
-	data.Set("auth", auth)
-	data.Set("goto", fmt.Sprintf("item?id=%d", itemID))
-
-	req, err = http.NewRequest("POST", voteURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err = c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusFound {
-		return errors.New("failed to upvote")
-	}
-
-	return nil
-}
-
-// Comment adds a comment to an item
-func (c *Client) Comment(itemID int, text string) error {
-	if !c.loggedIn {
-		return errors.New("you must be logged in to comment")
-	}
-
-	// First, visit the item page to extract any potential CSRF token
-	itemURL := fmt.Sprintf("%s/item?id=%d", c.webBase, itemID)
-	req, err := http.NewRequest("GET", itemURL, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	// Extract CSRF token if present
-	csrfRe := regexp.MustCompile(`name="csrf" value="([^"]+)"`)
-	csrfMatches := csrfRe.FindSubmatch(body)
-	if len(csrfMatches) > 1 {
-		c.csrf = string(csrfMatches[1])
-	}
-
-	// Extract form action URL
-	formRe := regexp.MustCompile(`<form action="([^"]+)" method="post"`)
-	formMatches := formRe.FindSubmatch(body)
-	if len(formMatches) < 2 {
-		return errors.New("comment form not found")
-	}
-	commentURL := fmt.Sprintf("%s/%s", c.webBase, string(formMatches[1]))
-
-	// Now post the comment
-	data := make(url.Values)
-	data.Set("text", text)
-	data.Set("parent", strconv.Itoa(itemID))
-	data.Set("goto", fmt.Sprintf("item?id=%d", itemID))
-	if c.csrf != "" {
-		data.Set("csrf", c.csrf)
-	}
-
-	req, err = http.NewRequest("POST", commentURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err = c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusFound {
-		return errors.New("failed to post comment")
-	}
-
-	return nil
-}
-
 // result represents the result of a GetItem operation
 type result struct {
 	item *types.Item
@@ -650,8 +363,16 @@ func (c *Client) writeToCache(storyType string, items []types.Item) error {
 	return nil
 }
 
+// StoriesPage is one page of a story list
+type StoriesPage struct {
+	Stories []types.Item
+	// Degraded is set when the API was unavailable and the stories were
+	// scraped from the website instead, so they lack some fields such as kids
+	Degraded bool
+}
+
 // GetStoriesPage fetches a specific page of stories
-func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache bool) ([]types.Item, error) {
+func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache bool) (*StoriesPage, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -663,10 +384,6 @@ func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache b
 	start := (page - 1) * perPage
 	end := start + perPage
 
-	if storyType == "paststories" {
-		storyType = "beststories"
-	}
-
 	var items []types.Item
 	var err error
 	var req *http.Request
@@ -683,6 +400,11 @@ func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache b
 		}
 	}
 
+	// While the API circuit is open, go straight to the website
+	if c.apiBreaker.isOpen() {
+		return c.scrapeStoriesPage(storyType, page)
+	}
+
 	// If cache miss or skipCache is true, fetch from API
 	url = fmt.Sprintf("%s/%s.json", c.apiBase, storyType)
 	req, err = http.NewRequest("GET", url, nil)
@@ -692,6 +414,9 @@ func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache b
 
 	err = c.doRequest(req, &ids)
 	if err != nil {
+		if scraped, scrapeErr := c.scrapeStoriesPage(storyType, page); scrapeErr == nil {
+			return scraped, nil
+		}
 		return nil, fmt.Errorf("failed to fetch story IDs: %v", err)
 	}
 
@@ -729,6 +454,11 @@ func (c *Client) GetStoriesPage(storyType string, page, perPage int, skipCache b
 		}
 	}
 
+	// The API went down while the items were being fetched
+	if len(items) == 0 && c.apiBreaker.isOpen() {
+		return c.scrapeStoriesPage(storyType, page)
+	}
+
 	// Write to cache if we got new data
 	if !skipCache {
 		if err := c.writeToCache(storyType, items); err != nil {
@@ -748,7 +478,7 @@ paginate:
 	// Get the items for this page
 	pageItems := items[start:end]
 
-	return pageItems, nil
+	return &StoriesPage{Stories: pageItems}, nil
 }
 
 // CommentWithStory represents a comment with its parent story information
@@ -911,22 +641,35 @@ func (c *Client) writeCommentsToCache(comments []CommentWithStory) error {
 
 // GetRootParent recursively fetches parent items until it finds the root story
 func (c *Client) GetRootParent(item *types.Item) (*types.Item, error) {
-	if item == nil {
-		return nil, fmt.Errorf("nil item")
+	ancestors, err := c.GetAncestors(item)
+	if err != nil {
+		return nil, err
 	}
 
-	// If this is already a story or has no parent, return it
-	if item.Type == "story" || item.Parent == 0 {
+	// A story or an item without a parent is its own root
+	if len(ancestors) == 0 {
 		return item, nil
 	}
+	return ancestors[0], nil
+}
+
+// GetAncestors fetches the items above item, from the root story down to
+// its parent. Stories and items without a parent have none.
+func (c *Client) GetAncestors(item *types.Item) ([]*types.Item, error) {
+	if item == nil {
+		return nil, fmt.Errorf("nil item")
+	}
 
 	// Add a safety check for potential infinite recursion
 	visited := make(map[int]bool)
+	var ancestors []*types.Item
 	current := item
-	depth := 0
 	maxDepth := 100 // Maximum depth to prevent infinite recursion
 
-	for current != nil && current.Parent > 0 && depth < maxDepth {
+	for current.Type != "story" && current.Parent > 0 {
+		if len(ancestors) >= maxDepth {
+			return nil, fmt.Errorf("max depth exceeded while finding root parent for item %d", item.ID)
+		}
 		if visited[current.ID] {
 			return nil, fmt.Errorf("circular reference detected at item %d", current.ID)
 		}
@@ -938,20 +681,13 @@ func (c *Client) GetRootParent(item *types.Item) (*types.Item, error) {
 			return nil, fmt.Errorf("failed to fetch parent %d: %v", current.Parent, err)
 		}
 
-		// If parent is a story or has no parent, we've found the root
-		if parent.Type == "story" || parent.Parent == 0 {
-			return parent, nil
-		}
-
+		ancestors = append(ancestors, parent)
 		current = parent
-		depth++
 	}
 
-	if depth >= maxDepth {
-		return nil, fmt.Errorf("max depth exceeded while finding root parent for item %d", item.ID)
-	}
-
-	return current, nil
+	// They were found from the bottom up
+	slices.Reverse(ancestors)
+	return ancestors, nil
 }
 
 // doRequest performs an HTTP request and unmarshals the response
@@ -961,12 +697,26 @@ func (c *Client) doRequest(req *http.Request, v interface{}) error {
 		c.logger.Printf("Making request to: %s", req.URL.String())
 	}
 
+	// Firebase requests go through the circuit breaker, so an outage fails
+	// fast instead of tying up a connection per item
+	api := strings.HasPrefix(req.URL.String(), c.apiBase)
+	if api && !c.apiBreaker.allow() {
+		return ErrAPIUnavailable
+	}
+
 	// Set request context with timeout
 	ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
 	defer cancel()
 	req = req.WithContext(ctx)
 
 	resp, err := c.httpClient.Do(req)
+	if api {
+		if err != nil || resp.StatusCode >= 500 {
+			c.apiBreaker.failure()
+		} else {
+			c.apiBreaker.success()
+		}
+	}
 	if err != nil {
 		if err == context.DeadlineExceeded {
 			return fmt.Errorf("request timed out after 30 seconds")
@@ -1022,6 +772,23 @@ func (c *Client) StopBackgroundJobs() {
 	close(c.stopChan)
 }
 
+// AddBackgroundJob runs job every interval until the background jobs are stopped
+func (c *Client) AddBackgroundJob(interval time.Duration, job func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				job()
+			}
+		}
+	}()
+}
+
 // backgroundJobs runs the background jobs for fetching stories and comments
 func (c *Client) backgroundJobs() {
 	ticker := time.NewTicker(2 * time.Minute)
@@ -1043,8 +810,13 @@ func (c *Client) backgroundJobs() {
 				continue
 			}
 
+			// Item pages come from the API, so there's nothing to cache while it's down
+			if stories.Degraded {
+				continue
+			}
+
 			// For each story, fetch and cache its item page
-			for _, story := range stories {
+			for _, story := range stories.Stories {
 				if _, err := c.GetItemPage(story.ID, true); err != nil {
 					c.logger.Printf("Error caching item page for story %d: %v", story.ID, err)
 				}
@@ -1059,16 +831,41 @@ func (c *Client) backgroundJobs() {
 	}
 }
 
-// IsLoggedIn returns whether the client is currently logged in
-func (c *Client) IsLoggedIn() bool {
-	return c.loggedIn
-}
-
 // ItemPage represents a cached item page with its comments
 type ItemPage struct {
-	Item     *types.Item   `json:"item"`
-	Comments []*types.Item `json:"comments"`
-	CachedAt time.Time     `json:"cached_at"`
+	Item *types.Item `json:"item"`
+	// Comments are the replies to the item, each with its own replies below it
+	Comments []*CommentNode `json:"comments"`
+	// Incomplete is set when some of the replies to the item itself could not
+	// be fetched in time
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Approximate is set when some of the comments are Algolia's copies,
+	// which aren't in HN's order and lack dead comments
+	Approximate bool `json:"approximate,omitempty"`
+	// Discussions lists earlier submissions of the same URL
+	Discussions []types.Item `json:"discussions,omitempty"`
+	CachedAt    time.Time    `json:"cached_at"`
+}
+
+const (
+	// itemPageMaxAge is how long a cached item page is served
+	itemPageMaxAge = 5 * time.Minute
+	// partialPageMaxAge is how long an incomplete or approximate page is
+	// served while it is rebuilt from the API in the background
+	partialPageMaxAge = time.Minute
+)
+
+// partial reports whether the page is incomplete or approximate
+func (p *ItemPage) partial() bool {
+	return p.Incomplete || p.Approximate || incompleteThread(p.Comments)
+}
+
+// maxAge returns how long the page is served from cache
+func (p *ItemPage) maxAge() time.Duration {
+	if p.partial() {
+		return partialPageMaxAge
+	}
+	return itemPageMaxAge
 }
 
 // loadItemPageFromCache loads an item page from cache
@@ -1088,6 +885,9 @@ func (c *Client) loadItemPageFromCache(itemID int) (*ItemPage, error) {
 	if err := json.Unmarshal(data, &page); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal cache file: %v", err)
 	}
+	if !validThread(page.Comments) {
+		return nil, fmt.Errorf("cache file %s has an outdated format", cacheFile)
+	}
 
 	return &page, nil
 }
@@ -1112,72 +912,107 @@ func (c *Client) writeItemPageToCache(itemID int, page *ItemPage) error {
 	return nil
 }
 
-// GetItemPage fetches an item and all its comments, using cache if available
+// GetItemPage fetches an item and all its comments, using cache if available.
+// Pages that were never cached come from Algolia's copy of the thread, which
+// takes one request instead of one per comment, falling back to the API.
 func (c *Client) GetItemPage(itemID int, skipCache bool) (*ItemPage, error) {
-	// Try to load from cache first if not skipping cache
-	if !skipCache {
-		page, err := c.loadItemPageFromCache(itemID)
-		if err == nil {
-			// Check if cache is fresh enough (less than 5 minutes old)
-			if time.Since(page.CachedAt) < 5*time.Minute {
-				return page, nil
+	return c.buildItemPage(itemID, skipCache, nil, nil)
+}
+
+// CachedItemPage returns an item's page if it is cached and still fresh
+// enough to serve, without fetching anything
+func (c *Client) CachedItemPage(itemID int) (*ItemPage, bool) {
+	page, err := c.loadItemPageFromCache(itemID)
+	if err != nil || time.Since(page.CachedAt) >= page.maxAge() {
+		return nil, false
+	}
+	return page, true
+}
+
+// StreamItemPage gets an item page like GetItemPage, handing out its parts
+// while the rest is still being fetched: start is called with the item as
+// soon as it is known, then emit with each top-level comment, in order, once
+// its thread is complete. Neither is called if an error is returned.
+func (c *Client) StreamItemPage(itemID int, start func(item *types.Item), emit func(node *CommentNode)) (*ItemPage, error) {
+	return c.buildItemPage(itemID, false, start, emit)
+}
+
+// buildItemPage does the work for GetItemPage and StreamItemPage, where
+// start and emit may be nil
+func (c *Client) buildItemPage(itemID int, skipCache bool, start func(item *types.Item), emit func(node *CommentNode)) (*ItemPage, error) {
+	if start == nil {
+		start = func(*types.Item) {}
+	}
+
+	cached, cacheErr := c.loadItemPageFromCache(itemID)
+	if !skipCache && cacheErr == nil && time.Since(cached.CachedAt) < cached.maxAge() {
+		if cached.partial() {
+			c.refreshItemPage(itemID)
+		}
+		start(cached.Item)
+		if emit != nil {
+			for _, node := range cached.Comments {
+				emit(node)
 			}
 		}
+		return cached, nil
 	}
 
 	// Fetch the main item
 	item, err := c.GetItem(itemID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a map to store all comments for O(1) lookup
-	commentMap := make(map[int]*types.Item)
-	comments := make([]*types.Item, 0)
-
-	// Fetch all comments recursively if this is a story or comment
-	if (item.Type == "story" || item.Type == "comment") && item.Kids != nil && len(item.Kids) > 0 {
-		for _, kidID := range item.Kids {
-			comment, err := c.GetItem(kidID)
-			if err != nil {
-				c.logger.Printf("Error fetching comment %d: %v", kidID, err)
-				continue
+	if err == nil {
+		start(item)
+	}
+
+	var comments []*CommentNode
+	complete := true
+	fetched := false
+	approximate := false
+	// Cold threads come from Algolia in one request, leaving the walk
+	// through the API to the background refresh
+	if cacheErr != nil || (!skipCache && cached.partial()) {
+		fast, nodes, ok, approx, fastErr := c.fetchThreadFast(itemID, item)
+		if fastErr != nil {
+			c.logger.Printf("Failed to fetch thread %d from Algolia, walking it through the API: %v", itemID, fastErr)
+		} else {
+			if item == nil {
+				item, err = fast, nil
+				start(item)
 			}
-			if comment != nil && !comment.Dead && !comment.Deleted {
-				comments = append(comments, comment)
-				commentMap[comment.ID] = comment
-				// Recursively fetch child comments
-				c.fetchChildComments(comment, &comments, commentMap)
+			comments, complete, approximate, fetched = nodes, ok, approx, true
+			if emit != nil {
+				for _, node := range comments {
+					emit(node)
+				}
 			}
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Sort comments to ensure parent comments come before their children
-	sortedComments := make([]*types.Item, 0, len(comments))
-	addedComments := make(map[int]bool)
-
-	// First add all top-level comments
-	for _, comment := range comments {
-		if comment.Parent == item.ID {
-			sortedComments = append(sortedComments, comment)
-			addedComments[comment.ID] = true
-		}
+	// Fetch the whole thread if this is a story or comment
+	if !fetched && (item.Type == "story" || item.Type == "comment") {
+		comments, complete = c.fetchThread(item, 0, emit)
 	}
 
-	// Then add remaining comments in parent-child order
-	for len(sortedComments) < len(comments) {
-		for _, comment := range comments {
-			if !addedComments[comment.ID] && addedComments[comment.Parent] {
-				sortedComments = append(sortedComments, comment)
-				addedComments[comment.ID] = true
-			}
+	// Look up earlier discussions of the same article. A streamed page loads
+	// them on its own through GetDiscussions, so it doesn't wait for them.
+	var discussions []types.Item
+	if emit == nil && item.Type == "story" && item.URL != "" {
+		discussions, err = c.FindDiscussions(item.URL, item.ID)
+		if err != nil {
+			c.logger.Printf("Failed to find earlier discussions for item %d: %v", itemID, err)
 		}
 	}
 
 	page := &ItemPage{
-		Item:     item,
-		Comments: sortedComments,
-		CachedAt: time.Now(),
+		Item:        item,
+		Comments:    comments,
+		Incomplete:  !complete,
+		Approximate: approximate,
+		Discussions: discussions,
+		CachedAt:    time.Now(),
 	}
 
 	// Write to cache
@@ -1185,26 +1020,33 @@ func (c *Client) GetItemPage(itemID int, skipCache bool) (*ItemPage, error) {
 		c.logger.Printf("Failed to write item page to cache: %v", err)
 	}
 
+	// Partial pages are only cached briefly, while the API fills them in
+	if page.partial() {
+		c.refreshItemPage(itemID)
+	}
+
 	return page, nil
 }
 
-// fetchChildComments is a helper function to recursively fetch child comments
-func (c *Client) fetchChildComments(parent *types.Item, allComments *[]*types.Item, commentMap map[int]*types.Item) {
-	if parent.Kids == nil || len(parent.Kids) == 0 {
+// refreshItemPage rebuilds an item page from the API in the background,
+// unless that is already under way
+func (c *Client) refreshItemPage(itemID int) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if c.refreshing[itemID] {
 		return
 	}
+	c.refreshing[itemID] = true
 
-	for _, kidID := range parent.Kids {
-		comment, err := c.GetItem(kidID)
-		if err != nil {
-			c.logger.Printf("Error fetching child comment %d: %v", kidID, err)
-			continue
-		}
-		if comment != nil && !comment.Dead && !comment.Deleted {
-			*allComments = append(*allComments, comment)
-			commentMap[comment.ID] = comment
-			// Recursively fetch this comment's children
-			c.fetchChildComments(comment, allComments, commentMap)
+	go func() {
+		defer func() {
+			c.refreshMu.Lock()
+			delete(c.refreshing, itemID)
+			c.refreshMu.Unlock()
+		}()
+
+		if _, err := c.GetItemPage(itemID, true); err != nil {
+			c.logger.Printf("Failed to refresh item page %d: %v", itemID, err)
 		}
-	}
+	}()
 }
@@ -0,0 +1,59 @@
+package hn
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tluyben/go-hn/types"
+)
+
+// Reply is a reply to one of a user's items
+type Reply struct {
+	Item   types.Item
+	Parent types.Item
+}
+
+// FindReplies returns the replies to the user's latest limit submissions,
+// newest first, leaving out the user's own replies and dead or deleted ones
+func (c *Client) FindReplies(username string, limit int) ([]Reply, error) {
+	user, err := c.GetUser(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user %s: %v", username, err)
+	}
+
+	submitted := user.Submitted
+	if limit > 0 && len(submitted) > limit {
+		submitted = submitted[:limit]
+	}
+
+	var replies []Reply
+	for _, id := range submitted {
+		// The index may have an older copy, and kids is exactly what changes
+		parent, err := c.fetchItemFromAPI(id)
+		if err != nil {
+			c.logger.Printf("Failed to fetch item %d of %s: %v", id, username, err)
+			continue
+		}
+		if parent.Dead || parent.Deleted {
+			continue
+		}
+
+		for _, kidID := range parent.Kids {
+			kid, err := c.GetItem(kidID)
+			if err != nil {
+				c.logger.Printf("Failed to fetch reply %d: %v", kidID, err)
+				continue
+			}
+			if kid.Dead || kid.Deleted || kid.By == username {
+				continue
+			}
+			replies = append(replies, Reply{Item: *kid, Parent: *parent})
+		}
+	}
+
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].Item.Time > replies[j].Item.Time
+	})
+
+	return replies, nil
+}
@@ -0,0 +1,170 @@
+package hn
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tluyben/go-hn/search"
+)
+
+// RetentionPolicy controls how long items stay in the search index and page cache
+type RetentionPolicy struct {
+	search.RetentionPolicy
+	// PageCacheMaxAge is how long ./cache/{id}.json item pages are kept; 0 keeps them forever
+	PageCacheMaxAge time.Duration
+	// Interval is how often the pruning job runs
+	Interval time.Duration
+	// KeepFavorites exempts the items returned by Favorites regardless of age
+	KeepFavorites bool
+	Favorites     func() (map[int]bool, error)
+}
+
+// PruneReport summarizes a pruning run
+type PruneReport struct {
+	IndexItemsDeleted   int
+	IndexBytesReclaimed int64
+	CacheFilesDeleted   int
+	CacheBytesReclaimed int64
+	Duration            time.Duration
+}
+
+// String formats the report for logging
+func (r *PruneReport) String() string {
+	return fmt.Sprintf("deleted %d index items (%d bytes) and %d cache files (%d bytes) in %v",
+		r.IndexItemsDeleted, r.IndexBytesReclaimed, r.CacheFilesDeleted, r.CacheBytesReclaimed, r.Duration)
+}
+
+// Prune removes expired items from the search index along with their cached
+// item pages, then removes item pages that are older than PageCacheMaxAge
+func (c *Client) Prune(policy RetentionPolicy) (*PruneReport, error) {
+	start := time.Now()
+	report := &PruneReport{}
+
+	sizeBefore, err := c.searchIndex.DiskUsage()
+	if err != nil {
+		c.logger.Printf("Failed to measure index size: %v", err)
+	}
+
+	if policy.KeepFavorites && policy.Favorites != nil {
+		favorites, err := policy.Favorites()
+		if err != nil {
+			return report, fmt.Errorf("failed to look up favorites: %v", err)
+		}
+		policy.Keep = favorites
+	}
+
+	deleted, err := c.searchIndex.Prune(policy.RetentionPolicy, func(ids []int) {
+		for _, id := range ids {
+			if size, ok := removeCacheFile(fmt.Sprintf("./cache/%d.json", id)); ok {
+				report.CacheFilesDeleted++
+				report.CacheBytesReclaimed += size
+			}
+		}
+	})
+	report.IndexItemsDeleted = deleted
+	if err != nil {
+		return report, err
+	}
+
+	if policy.PageCacheMaxAge > 0 {
+		files, bytes, err := c.prunePageCache(policy.PageCacheMaxAge, policy.Keep)
+		report.CacheFilesDeleted += files
+		report.CacheBytesReclaimed += bytes
+		if err != nil {
+			return report, err
+		}
+	}
+
+	// Deleted documents are only dropped from disk as segments are merged,
+	// so this is a lower bound right after the run
+	if sizeAfter, err := c.searchIndex.DiskUsage(); err == nil && sizeBefore > sizeAfter {
+		report.IndexBytesReclaimed = sizeBefore - sizeAfter
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// prunePageCache removes cached item pages last written before maxAge ago,
+// except those of the items in keep
+func (c *Client) prunePageCache(maxAge time.Duration, keep map[int]bool) (int, int64, error) {
+	entries, err := os.ReadDir("./cache")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("failed to read cache directory: %v", err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	files := 0
+	var bytes int64
+	for _, entry := range entries {
+		// Only item pages are named after a bare item ID
+		id, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if keep[id] {
+			continue
+		}
+
+		if size, ok := removeCacheFile(filepath.Join("./cache", entry.Name())); ok {
+			files++
+			bytes += size
+		}
+	}
+
+	return files, bytes, nil
+}
+
+// removeCacheFile deletes a cache file and returns its size, or false if there was nothing to delete
+func removeCacheFile(path string) (int64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// StartRetentionJob runs Prune in the background every policy.Interval until
+// the background jobs are stopped
+func (c *Client) StartRetentionJob(policy RetentionPolicy) {
+	if policy.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				report, err := c.Prune(policy)
+				if err != nil {
+					log.Printf("Error pruning index and cache: %v", err)
+				}
+				if report != nil {
+					log.Printf("Retention job %s", report)
+				}
+			}
+		}
+	}()
+}
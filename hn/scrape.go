@@ -0,0 +1,65 @@
+package hn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tluyben/go-hn/scraper"
+	"github.com/tluyben/go-hn/types"
+)
+
+// storyListPaths maps story types to the website pages that list them
+var storyListPaths = map[string]string{
+	"topstories":  "news",
+	"newstories":  "newest",
+	"beststories": "best",
+	"askstories":  "ask",
+	"showstories": "show",
+	"jobstories":  "jobs",
+}
+
+// scrapeStoriesPage reads a page of a story list from the website, for when
+// the API is unavailable. The website always lists 30 stories per page.
+func (c *Client) scrapeStoriesPage(storyType string, page int) (*StoriesPage, error) {
+	path, ok := storyListPaths[storyType]
+	if !ok {
+		return nil, fmt.Errorf("no website listing for story type: %s", storyType)
+	}
+
+	stories, err := c.scrapeStoryList(fmt.Sprintf("%s?p=%d", path, page))
+	if err != nil {
+		return nil, err
+	}
+	if len(stories) == 0 {
+		return nil, fmt.Errorf("page %d exceeds available stories", page)
+	}
+
+	c.logger.Printf("Hacker News API unavailable, scraped %d %s from the website", len(stories), storyType)
+	return &StoriesPage{Stories: stories, Degraded: true}, nil
+}
+
+// scrapeStoryList fetches a story list page from the website and parses it
+func (c *Client) scrapeStoryList(path string) ([]types.Item, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", c.webBase, path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	stories, err := scraper.ParseStories(resp.Body, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return stories, nil
+}
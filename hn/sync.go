@@ -0,0 +1,222 @@
+package hn
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tluyben/go-hn/state"
+)
+
+// userList is one of the lists of items HN keeps for a user
+type userList struct {
+	// name is the key of the list's checkpoint
+	name string
+	// path is the list's first page, with {user} standing for the username
+	path string
+	// flag picks the flag the list stands for out of an item's flags
+	flag func(f *state.Flags) *bool
+}
+
+// userLists are the lists imported for each user. Favorites are public, the
+// upvoted and hidden lists are only shown to the user themselves, so the
+// flags are kept in the user's state rather than the shared index.
+var userLists = []userList{
+	{"favorites", "favorites?id={user}", favoriteFlag},
+	{"favorite-comments", "favorites?id={user}&comments=t", favoriteFlag},
+	{"upvoted", "upvoted?id={user}", upvotedFlag},
+	{"upvoted-comments", "upvoted?id={user}&comments=t", upvotedFlag},
+	{"hidden", "hidden", func(f *state.Flags) *bool { return &f.Hidden }},
+}
+
+func favoriteFlag(f *state.Flags) *bool { return &f.Favorite }
+
+func upvotedFlag(f *state.Flags) *bool { return &f.Upvoted }
+
+// sameFlag reports whether two lists stand for the same flag, like a user's
+// favorite stories and favorite comments
+func sameFlag(a, b userList) bool {
+	var f state.Flags
+	return a.flag(&f) == b.flag(&f)
+}
+
+// maxSyncPages bounds how many pages of a list one run imports, which spreads
+// the first import of a long list over several runs
+const maxSyncPages = 10
+
+// fullSyncInterval is how often a list is walked in full, to clear the flags
+// of items that were removed from it on HN
+const fullSyncInterval = 24 * time.Hour
+
+// ListPage fetches a page of one of the user's lists, returning the IDs of
+// the items on it and the path of the next page, or "" on the last page
+func (a *Account) ListPage(path string) ([]int, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loggedIn {
+		return nil, "", errors.New("you must be logged in to read your lists")
+	}
+
+	page, _, err := a.getPage(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if page.RateLimited {
+		return nil, "", pageError(page, "")
+	}
+	if !page.LoggedIn() {
+		return nil, "", ErrSessionExpired
+	}
+
+	return page.Items, page.More, nil
+}
+
+// SyncUserLists imports the account's favorites, upvoted and hidden items,
+// indexing the items and flagging them in the user's state, and returns how
+// many it imported.
+// Progress is kept in store after every page, so an interrupted import
+// continues where it stopped and later runs only import what was added since.
+func (c *Client) SyncUserLists(a *Account, store *state.Store) (int, error) {
+	username := a.Username()
+	if username == "" {
+		return 0, errors.New("you must be logged in to import your lists")
+	}
+
+	imported := 0
+	for _, list := range userLists {
+		n, err := c.syncUserList(a, username, list, store)
+		imported += n
+		if err != nil {
+			return imported, fmt.Errorf("failed to import %s of %s: %v", list.name, username, err)
+		}
+	}
+
+	return imported, nil
+}
+
+// syncUserList imports up to maxSyncPages pages of a list, stopping at the
+// newest item of the last complete import. Once every fullSyncInterval it
+// walks the whole list instead, and clears the flag on the items that are no
+// longer on it.
+func (c *Client) syncUserList(a *Account, username string, list userList, store *state.Store) (int, error) {
+	var cp state.SyncCheckpoint
+	err := store.View(username, func(u *state.User) {
+		if saved := u.Sync[list.name]; saved != nil {
+			cp = *saved
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	path := cp.Next
+	if path == "" {
+		path = strings.ReplaceAll(list.path, "{user}", username)
+		cp.RunNewest = 0
+		cp.Full = time.Since(cp.LastFull) >= fullSyncInterval
+		cp.Seen = nil
+	}
+
+	imported := 0
+	for pages := 0; pages < maxSyncPages; pages++ {
+		ids, more, err := a.ListPage(path)
+		if err != nil {
+			return imported, err
+		}
+		if cp.RunNewest == 0 && len(ids) > 0 {
+			cp.RunNewest = ids[0]
+		}
+
+		caughtUp := false
+		var marked []int
+		for _, id := range ids {
+			if id == cp.Newest && !cp.Full {
+				caughtUp = true
+				break
+			}
+			if cp.Full {
+				cp.Seen = append(cp.Seen, id)
+			}
+			// Items from earlier imports only need to be seen
+			if slices.Contains(cp.Items, id) {
+				continue
+			}
+			// A failed item fails the page, which is retried on the next run
+			item, err := c.GetItem(id)
+			if err != nil {
+				return imported, err
+			}
+			if err := c.searchIndex.IndexItem(item); err != nil {
+				return imported, err
+			}
+			marked = append(marked, id)
+			imported++
+		}
+		cp.Items = append(cp.Items, marked...)
+
+		var removed []int
+		if caughtUp || more == "" {
+			if cp.RunNewest != 0 {
+				cp.Newest = cp.RunNewest
+			}
+			if cp.Full {
+				for _, id := range cp.Items {
+					if !slices.Contains(cp.Seen, id) {
+						removed = append(removed, id)
+					}
+				}
+				cp.Items, cp.Seen = cp.Seen, nil
+				cp.Full = false
+				cp.LastFull = time.Now()
+			}
+			cp.Next = ""
+			cp.RunNewest = 0
+			cp.LastSync = time.Now()
+		} else {
+			cp.Next = more
+		}
+
+		err = store.Update(username, func(u *state.User) {
+			if u.Sync == nil {
+				u.Sync = make(map[string]*state.SyncCheckpoint)
+			}
+			saved := cp
+			u.Sync[list.name] = &saved
+			for _, id := range marked {
+				u.SetFlag(id, list.flag, true)
+			}
+			for _, id := range removed {
+				if !flaggedByOtherList(u, list, id) {
+					u.SetFlag(id, list.flag, false)
+				}
+			}
+		})
+		if err != nil {
+			return imported, err
+		}
+
+		if cp.Next == "" {
+			break
+		}
+		path = cp.Next
+	}
+
+	return imported, nil
+}
+
+// flaggedByOtherList reports whether another list that stands for the same
+// flag still has the item
+func flaggedByOtherList(u *state.User, list userList, id int) bool {
+	for _, other := range userLists {
+		if other.name == list.name || !sameFlag(list, other) {
+			continue
+		}
+		if cp := u.Sync[other.name]; cp != nil && slices.Contains(cp.Items, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package hn
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tluyben/go-hn/state"
+)
+
+// listPage renders one of a user's lists the way HN does, with a More link
+// when more is set
+func listPage(ids []int, more string) string {
+	var b strings.Builder
+	b.WriteString(`<html><body><a id="me" href="user?id=alice">alice</a><table>`)
+	for _, id := range ids {
+		fmt.Fprintf(&b, `<tr class="athing" id="%d"><td class="title"><span class="titleline"><a href="item?id=%d">Item</a></span></td></tr>`, id, id)
+	}
+	b.WriteString(`</table>`)
+	if more != "" {
+		fmt.Fprintf(&b, `<a href="%s" class="morelink" rel="next">More</a>`, more)
+	}
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+func TestSyncUserLists(t *testing.T) {
+	firebase := map[int]string{}
+	for _, id := range []int{10, 11, 12, 13, 20, 30} {
+		firebase[id] = fmt.Sprintf(`{"id":%d,"type":"story","by":"pg","time":1000,"title":"Item %d"}`, id, id)
+	}
+	s := newStandIn(t, firebase, nil)
+	c := newTestClient(t, s)
+
+	a, err := c.NewAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.loggedIn = true
+	a.username = "alice"
+
+	store, err := state.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := func() map[int]state.Flags {
+		var flags map[int]state.Flags
+		if err := store.View("alice", func(u *state.User) { flags = u.ItemFlags() }); err != nil {
+			t.Fatal(err)
+		}
+		return flags
+	}
+
+	s.setPage("favorites?id=alice", listPage([]int{12, 11}, "favorites?id=alice&p=2"))
+	s.setPage("favorites?id=alice&p=2", listPage([]int{10}, ""))
+	s.setPage("favorites?id=alice&comments=t", listPage([]int{20}, ""))
+	s.setPage("upvoted?id=alice", listPage([]int{10}, ""))
+	s.setPage("upvoted?id=alice&comments=t", listPage(nil, ""))
+	s.setPage("hidden", listPage([]int{30}, ""))
+
+	imported, err := c.SyncUserLists(a, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 6 {
+		t.Errorf("imported %d items, want 6", imported)
+	}
+	want := map[int]state.Flags{
+		10: {Favorite: true, Upvoted: true},
+		11: {Favorite: true},
+		12: {Favorite: true},
+		20: {Favorite: true},
+		30: {Hidden: true},
+	}
+	if got := flags(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+
+	// 13 is favorited and 10 unfavorited on HN. The next run only reads up
+	// to the items it already has, so it adds 13 but can't tell 10 is gone.
+	s.setPage("favorites?id=alice", listPage([]int{13, 12, 11}, ""))
+	if _, err := c.SyncUserLists(a, store); err != nil {
+		t.Fatal(err)
+	}
+	want[13] = state.Flags{Favorite: true}
+	if got := flags(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+
+	// Once a full walk is due, 10 loses the favorite flag but stays upvoted,
+	// and the unhidden 30 loses its flags altogether
+	s.setPage("hidden", listPage(nil, ""))
+	err = store.Update("alice", func(u *state.User) {
+		for _, cp := range u.Sync {
+			cp.LastFull = time.Now().Add(-fullSyncInterval)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err = c.SyncUserLists(a, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 0 {
+		t.Errorf("imported %d items in a full walk of known items, want 0", imported)
+	}
+	want[10] = state.Flags{Upvoted: true}
+	delete(want, 30)
+	if got := flags(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package hn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/tluyben/go-hn/types"
+)
+
+// algoliaItem is an item as Algolia's items endpoint returns it, with the
+// whole thread below it nested in Children
+type algoliaItem struct {
+	ID         int           `json:"id"`
+	CreatedAtI int           `json:"created_at_i"`
+	Type       string        `json:"type"`
+	Author     string        `json:"author"`
+	Title      string        `json:"title"`
+	URL        string        `json:"url"`
+	Text       string        `json:"text"`
+	Points     int           `json:"points"`
+	ParentID   int           `json:"parent_id"`
+	Children   []algoliaItem `json:"children"`
+}
+
+// fetchAlgoliaThread fetches an item and every comment below it in a single
+// request to Algolia, which is much faster than walking the thread through
+// the API one comment at a time
+func (c *Client) fetchAlgoliaThread(itemID int) (*types.Item, map[int]*types.Item, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/items/%d", c.searchBase, itemID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var root algoliaItem
+	if err := c.doRequest(req, &root); err != nil {
+		return nil, nil, err
+	}
+	if root.ID != itemID {
+		return nil, nil, fmt.Errorf("algolia returned item %d instead of %d", root.ID, itemID)
+	}
+
+	items := make(map[int]*types.Item)
+	item, _ := addAlgoliaItem(items, &root)
+	return item, items, nil
+}
+
+// addAlgoliaItem converts ai and everything below it into items, keyed by
+// ID, and returns the converted ai along with the number of comments below
+// it. Algolia keeps deleted comments that have replies, without an author or
+// text, and leaves out dead ones.
+func addAlgoliaItem(items map[int]*types.Item, ai *algoliaItem) (*types.Item, int) {
+	item := &types.Item{
+		ID:     ai.ID,
+		Type:   ai.Type,
+		By:     ai.Author,
+		Time:   ai.CreatedAtI,
+		Text:   ai.Text,
+		Parent: ai.ParentID,
+		URL:    ai.URL,
+		Score:  ai.Points,
+		Title:  ai.Title,
+	}
+	if item.Type == "comment" && item.By == "" && item.Text == "" {
+		item.Deleted = true
+	}
+	items[item.ID] = item
+
+	descendants := 0
+	for i := range ai.Children {
+		child, below := addAlgoliaItem(items, &ai.Children[i])
+		item.Kids = append(item.Kids, child.ID)
+		descendants += below
+		if !child.Deleted {
+			descendants++
+		}
+	}
+	// HN only counts descendants on stories
+	if item.Type == "story" || item.Type == "poll" {
+		item.Descendants = descendants
+	}
+
+	return item, descendants
+}
+
+// fetchThreadFast builds the thread below an item from Algolia's copy.
+// apiItem is the item as the API has it, if it could be fetched. Algolia
+// lists nested replies by time rather than HN's ranking and leaves out dead
+// comments and scores, so it is only used for comments the index doesn't
+// have from the API, and backfills the index marked as approximate, which
+// the API's copies replace. The replies the API lists that Algolia doesn't
+// have, such as dead comments and very recent ones, are fetched from the API
+// within threadDeadline, at every level. approximate is set when any of
+// Algolia's copies were used.
+func (c *Client) fetchThreadFast(itemID int, apiItem *types.Item) (item *types.Item, comments []*CommentNode, complete, approximate bool, err error) {
+	item, items, err := c.fetchAlgoliaThread(itemID)
+	if err != nil {
+		return nil, nil, false, false, err
+	}
+	if apiItem != nil {
+		merged := *apiItem
+		merged.Kids, approximate = mergeKids(apiItem.Kids, item.Kids)
+		item = &merged
+		items[itemID] = item
+	} else {
+		c.logger.Printf("Using Algolia's copy of item %d", itemID)
+		approximate = true
+		c.backfill(item)
+	}
+
+	var missing []int
+	var check func(kids []int)
+	check = func(kids []int) {
+		for _, kidID := range kids {
+			kid, ok := items[kidID]
+			if !ok {
+				missing = append(missing, kidID)
+				continue
+			}
+			if si, err := c.searchIndex.GetItem(kidID); err == nil && !si.Approximate {
+				indexed := searchableToItem(si)
+				// The indexed copy may predate replies Algolia already has
+				var newer bool
+				indexed.Kids, newer = mergeKids(indexed.Kids, kid.Kids)
+				approximate = approximate || newer
+				kid = &indexed
+				items[kidID] = kid
+			} else {
+				approximate = true
+				c.backfill(kid)
+			}
+			check(kid.Kids)
+		}
+	}
+	check(item.Kids)
+
+	if len(missing) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), threadDeadline)
+		defer cancel()
+		for id, it := range c.fetchTree(ctx, missing, nil) {
+			items[id] = it
+		}
+	}
+
+	comments, complete = buildThread(items, item.Kids, 0)
+	return item, comments, complete, approximate, nil
+}
+
+// backfill queues Algolia's copy of an item for the index
+func (c *Client) backfill(item *types.Item) {
+	if err := c.searchIndex.Backfill(item); err != nil {
+		c.logger.Printf("Failed to backfill item %d: %v", item.ID, err)
+	}
+}
+
+// mergeKids returns kids followed by the IDs in more that it doesn't have,
+// and whether there were any
+func mergeKids(kids, more []int) ([]int, bool) {
+	merged := kids
+	for _, id := range more {
+		if !slices.Contains(kids, id) {
+			if len(merged) == len(kids) {
+				merged = slices.Clone(kids)
+			}
+			merged = append(merged, id)
+		}
+	}
+	return merged, len(merged) > len(kids)
+}
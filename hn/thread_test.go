@@ -0,0 +1,381 @@
+package hn
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tluyben/go-hn/types"
+)
+
+// TestMain runs the tests in a scratch directory, as the client keeps its
+// search index and page cache under the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "hn-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// standIn serves Firebase items under /fb, Algolia threads under /algolia
+// and HN's web pages under /web, and counts the requests for each path
+type standIn struct {
+	*httptest.Server
+	firebase map[int]string
+	algolia  map[int]string
+
+	mu       sync.Mutex
+	requests map[string]int
+	// web holds the web pages by path and query, such as "hidden?p=2", and
+	// redirects the ones HN answers with a redirect
+	web       map[string]string
+	redirects map[string]string
+}
+
+func newStandIn(t *testing.T, firebase, algolia map[int]string) *standIn {
+	s := &standIn{
+		firebase:  firebase,
+		algolia:   algolia,
+		requests:  make(map[string]int),
+		web:       make(map[string]string),
+		redirects: make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		page, isPage := s.web[strings.TrimPrefix(r.URL.RequestURI(), "/web/")]
+		target, isRedirect := s.redirects[strings.TrimPrefix(r.URL.RequestURI(), "/web/")]
+		s.mu.Unlock()
+
+		if isRedirect {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+
+		var id int
+		var body string
+		var ok bool
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/web/"):
+			body, ok = page, isPage
+		case strings.HasPrefix(r.URL.Path, "/fb/item/"):
+			fmt.Sscanf(r.URL.Path, "/fb/item/%d.json", &id)
+			body, ok = s.firebase[id]
+		case strings.HasPrefix(r.URL.Path, "/algolia/items/"):
+			fmt.Sscanf(r.URL.Path, "/algolia/items/%d", &id)
+			body, ok = s.algolia[id]
+		}
+		if !ok {
+			http.Error(w, "not found", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// count returns how often path was requested
+func (s *standIn) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// setPage serves body as the web page at path
+func (s *standIn) setPage(path, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.web[path] = body
+}
+
+// setRedirect answers requests for path with a redirect to target
+func (s *standIn) setRedirect(path, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redirects[path] = target
+}
+
+// newTestClient returns a client that talks to the stand-in
+func newTestClient(t *testing.T, s *standIn) *Client {
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetBaseURLs(s.URL+"/fb", s.URL+"/web", s.URL+"/algolia")
+	return c
+}
+
+// shape describes a thread as "id(child child) id", for comparing trees
+func shape(nodes []*CommentNode) string {
+	var parts []string
+	for _, node := range nodes {
+		part := fmt.Sprint(node.Item.ID)
+		if len(node.Children) > 0 {
+			part += "(" + shape(node.Children) + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// The API ranks 102 above 101, and lists a reply 104 to the story and a
+// reply 105 to 101 that Algolia hasn't picked up yet
+var fastFirebase = map[int]string{
+	100: `{"id":100,"type":"story","by":"pg","time":1000,"title":"Story","kids":[102,101,104]}`,
+	101: `{"id":101,"type":"comment","by":"a","time":1001,"text":"first","parent":100,"kids":[103,105]}`,
+	102: `{"id":102,"type":"comment","by":"b","time":1002,"text":"second","parent":100}`,
+	103: `{"id":103,"type":"comment","by":"c","time":1003,"text":"reply","parent":101}`,
+	104: `{"id":104,"type":"comment","by":"d","time":1004,"text":"late","parent":100}`,
+	105: `{"id":105,"type":"comment","by":"e","time":1005,"text":"late reply","parent":101}`,
+}
+
+var fastAlgolia = map[int]string{
+	100: `{"id":100,"type":"story","author":"pg","created_at_i":1000,"title":"Story","children":[
+		{"id":101,"type":"comment","author":"a","created_at_i":1001,"text":"first","parent_id":100,"children":[
+			{"id":103,"type":"comment","author":"c","created_at_i":1003,"text":"reply","parent_id":101,"children":[]}
+		]},
+		{"id":102,"type":"comment","author":"b","created_at_i":1002,"text":"second","parent_id":100,"children":[]}
+	]}`,
+}
+
+func TestFetchThreadFast(t *testing.T) {
+	s := newStandIn(t, fastFirebase, fastAlgolia)
+	c := newTestClient(t, s)
+
+	story, err := c.GetItem(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, comments, complete, approximate, err := c.fetchThreadFast(100, story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 100 || item.Title != "Story" {
+		t.Errorf("item = %d %q, want 100 \"Story\"", item.ID, item.Title)
+	}
+	// The API's order at the top, and the reply Algolia lacks fetched from it
+	if got, want := shape(comments), "102 101(103) 104"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if !complete {
+		t.Error("thread is incomplete")
+	}
+	if !approximate {
+		t.Error("thread built from Algolia's copies isn't approximate")
+	}
+	if n := s.count("/algolia/items/100"); n != 1 {
+		t.Errorf("fetched Algolia's thread %d times, want 1", n)
+	}
+
+	// What came from the API is queued for the index as is, and Algolia's
+	// copies of the rest backfill it marked as approximate
+	for id, want := range map[int]bool{100: false, 104: false, 101: true, 102: true, 103: true} {
+		si, err := c.searchIndex.GetItem(id)
+		if err != nil {
+			t.Errorf("item %d wasn't queued for the index: %v", id, err)
+		} else if si.Approximate != want {
+			t.Errorf("item %d approximate = %v, want %v", id, si.Approximate, want)
+		}
+	}
+
+	// Once the API's copy of 101 is indexed, its reply Algolia lacks is
+	// fetched as well
+	if _, err := c.GetItem(101); err != nil {
+		t.Fatal(err)
+	}
+	_, comments, _, approximate, err = c.fetchThreadFast(100, story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := shape(comments), "102 101(103 105) 104"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if !approximate {
+		t.Error("thread with Algolia's copies of 102 and 103 isn't approximate")
+	}
+
+	// Algolia's copy of 101 never replaces the API's, queued or written
+	if err := c.searchIndex.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.searchIndex.Backfill(&types.Item{ID: 101, Type: "comment", Text: "stale", Parent: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.searchIndex.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if si, err := c.searchIndex.GetItem(101); err != nil || si.Approximate || len(si.Kids) != 2 {
+		t.Errorf("index has %+v (%v), want the API's copy of 101", si, err)
+	}
+
+	// With every comment indexed, nothing of Algolia's is left
+	for _, id := range []int{102, 103} {
+		if _, err := c.GetItem(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, _, approximate, err = c.fetchThreadFast(100, story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approximate {
+		t.Error("thread built from indexed items is approximate")
+	}
+}
+
+func TestFetchThreadFastWithoutAPIItem(t *testing.T) {
+	algolia := map[int]string{
+		200: `{"id":200,"type":"story","author":"pg","created_at_i":2000,"title":"Only on Algolia","children":[
+			{"id":201,"type":"comment","author":"a","created_at_i":2001,"text":"one","parent_id":200,"children":[]},
+			{"id":202,"type":"comment","author":"","created_at_i":2002,"text":"","parent_id":200,"children":[
+				{"id":203,"type":"comment","author":"b","created_at_i":2003,"text":"two","parent_id":202,"children":[]}
+			]}
+		]}`,
+	}
+	s := newStandIn(t, nil, algolia)
+	c := newTestClient(t, s)
+
+	item, comments, complete, approximate, err := c.fetchThreadFast(200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "Only on Algolia" || item.Descendants != 2 {
+		t.Errorf("item = %q with %d descendants, want \"Only on Algolia\" with 2", item.Title, item.Descendants)
+	}
+	// The deleted comment stays as a placeholder for its reply
+	if got, want := shape(comments), "201 202(203)"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if !comments[1].Item.Deleted {
+		t.Error("comment without author or text isn't deleted")
+	}
+	if !complete || !approximate {
+		t.Errorf("complete = %v, approximate = %v, want both", complete, approximate)
+	}
+}
+
+func TestItemPageFallsBackToAPI(t *testing.T) {
+	firebase := map[int]string{
+		300: `{"id":300,"type":"story","by":"pg","time":3000,"title":"Story","kids":[301]}`,
+		301: `{"id":301,"type":"comment","by":"a","time":3001,"text":"one","parent":300,"kids":[302]}`,
+		302: `{"id":302,"type":"comment","by":"b","time":3002,"text":"two","parent":301}`,
+	}
+	// Algolia fails for item 300
+	s := newStandIn(t, firebase, nil)
+	c := newTestClient(t, s)
+
+	page, err := c.GetItemPage(300, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.count("/algolia/items/300") != 1 {
+		t.Error("Algolia wasn't tried first")
+	}
+	if got, want := shape(page.Comments), "301(302)"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if page.Incomplete || page.Approximate {
+		t.Errorf("incomplete = %v, approximate = %v, want neither", page.Incomplete, page.Approximate)
+	}
+	for _, id := range []int{301, 302} {
+		if _, err := c.searchIndex.GetItem(id); err != nil {
+			t.Errorf("item %d wasn't queued for the index: %v", id, err)
+		}
+	}
+}
+
+func TestApproximatePageIsRebuilt(t *testing.T) {
+	firebase := map[int]string{
+		400: `{"id":400,"type":"story","by":"pg","time":4000,"title":"Story","kids":[402,401]}`,
+		401: `{"id":401,"type":"comment","by":"a","time":4001,"text":"one","parent":400}`,
+		402: `{"id":402,"type":"comment","by":"b","time":4002,"text":"two","parent":400}`,
+	}
+	algolia := map[int]string{
+		400: `{"id":400,"type":"story","author":"pg","created_at_i":4000,"title":"Story","children":[
+			{"id":401,"type":"comment","author":"a","created_at_i":4001,"text":"one","parent_id":400,"children":[]},
+			{"id":402,"type":"comment","author":"b","created_at_i":4002,"text":"two","parent_id":400,"children":[]}
+		]}`,
+	}
+	s := newStandIn(t, firebase, algolia)
+	c := newTestClient(t, s)
+
+	// Hold off the background refresh until the cached copy was served
+	c.refreshMu.Lock()
+	c.refreshing[400] = true
+	c.refreshMu.Unlock()
+
+	page, err := c.GetItemPage(400, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Approximate {
+		t.Fatal("page built from Algolia isn't approximate")
+	}
+
+	// The next visit is served the cached copy rather than walking the API
+	page, err = c.GetItemPage(400, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Approximate || s.count("/fb/item/401.json") != 0 {
+		t.Error("the cached copy wasn't served")
+	}
+
+	// The refresh walks the API, and later visits get its page from cache
+	c.refreshMu.Lock()
+	delete(c.refreshing, 400)
+	c.refreshMu.Unlock()
+	c.refreshItemPage(400)
+	waitForRefresh(t, c, 400)
+
+	page, err = c.GetItemPage(400, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Approximate {
+		t.Error("page is still approximate after the API walk")
+	}
+	if s.count("/fb/item/401.json") != 1 || s.count("/fb/item/402.json") != 1 {
+		t.Error("comments weren't fetched from the API once")
+	}
+	if s.count("/algolia/items/400") != 1 {
+		t.Errorf("fetched Algolia's thread %d times, want 1", s.count("/algolia/items/400"))
+	}
+	if got, want := shape(page.Comments), "402 401"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if !slices.Equal(page.Item.Kids, []int{402, 401}) {
+		t.Errorf("kids = %v, want [402 401]", page.Item.Kids)
+	}
+}
+
+// waitForRefresh waits for the background refresh of an item page to finish
+func waitForRefresh(t *testing.T, c *Client, itemID int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		c.refreshMu.Lock()
+		refreshing := c.refreshing[itemID]
+		c.refreshMu.Unlock()
+		if !refreshing {
+			return
+		}
+	}
+	t.Fatalf("item page %d is still being refreshed", itemID)
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
-	"html"
 	"html/template"
 	"log"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/tluyben/go-hn/config"
 	"github.com/tluyben/go-hn/hn"
+	"github.com/tluyben/go-hn/render"
 	"github.com/tluyben/go-hn/search"
+	"github.com/tluyben/go-hn/session"
+	"github.com/tluyben/go-hn/state"
 	"github.com/tluyben/go-hn/types"
 )
 
@@ -22,10 +29,23 @@ import (
 var content embed.FS
 
 var (
+	cfg         *config.Config
 	searchIndex *search.Index
 	client      *hn.Client
+	sessions    *session.Store
+	userState   *state.Store
 )
 
+const (
+	// threadsPerPage is how many replies to an item are rendered at a time
+	threadsPerPage = 30
+	// threadDepth is how many levels of replies are rendered at a time
+	threadDepth = 5
+)
+
+// inboxSubmissions is how many of a user's latest submissions are checked for replies
+const inboxSubmissions = 30
+
 // Settings struct for user preferences
 type Settings struct {
 	Theme string `json:"theme"`
@@ -63,20 +83,32 @@ var funcMap = template.FuncMap{
 		if urlStr == "" {
 			return ""
 		}
-		u, err := url.Parse(urlStr)
-		if err != nil {
-			return urlStr
-		}
-		return u.Host
+		return search.Domain(urlStr)
+	},
+	// sanitize renders HN's HTML, keeping only the few tags HN itself uses
+	// and highlighting code blocks
+	"sanitize": func(s string) template.HTML {
+		return template.HTML(render.Text(s))
+	},
+	"excerpt": func(s string) string {
+		return render.Excerpt(s, 200)
 	},
-	"unescape": func(s string) template.HTML {
-		return template.HTML(html.UnescapeString(s))
+	"editable": func(unixTime int) bool {
+		return time.Since(time.Unix(int64(unixTime), 0)) < hn.EditWindow
 	},
-	"hasVoted": func(dir *int, val int) bool {
-		if dir == nil {
-			return false
+	// hasVoted reports whether the user's flags from createTemplateData
+	// have a vote in direction val on the item. HN only lists upvotes.
+	"hasVoted": func(flags map[int]state.Flags, id, val int) bool {
+		return val == 1 && flags[id].Upvoted
+	},
+	// newComments is how many comments a story got since the user last
+	// opened it, given the counts from CommentCounts
+	"newComments": func(commentCounts map[int]int, id, descendants int) int {
+		count, ok := commentCounts[id]
+		if !ok {
+			return 0
 		}
-		return *dir == val
+		return max(descendants-count, 0)
 	},
 	"dict": func(values ...interface{}) (map[string]interface{}, error) {
 		if len(values)%2 != 0 {
@@ -97,6 +129,11 @@ var funcMap = template.FuncMap{
 // Initialize search index and HN client
 func init() {
 	var err error
+	cfg, err = config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	searchIndex, err = search.GetIndex()
 	if err != nil {
 		log.Fatalf("Failed to initialize search index: %v", err)
@@ -106,17 +143,121 @@ func init() {
 	if err != nil {
 		log.Fatalf("Failed to initialize HN client: %v", err)
 	}
+	client.SetBaseURLs(cfg.APIBase, cfg.WebBase, cfg.SearchBase)
 
 	// Start background jobs for fetching stories and comments
 	client.StartBackgroundJobs()
+	client.StartRetentionJob(retentionPolicy(cfg))
 	log.Println("Background jobs started successfully")
+
+	sessions = session.NewStore(cfg.SessionTTL)
+	if cfg.SessionKey != nil {
+		if err := sessions.EnablePersistence("data/sessions.enc", cfg.SessionKey); err != nil {
+			log.Fatalf("Failed to enable session persistence: %v", err)
+		}
+		// Checking saved logins against HN can be slow, so don't hold up startup
+		go func() {
+			restored, err := sessions.Restore(client.RestoreAccount)
+			if err != nil {
+				log.Printf("Error restoring sessions: %v", err)
+			}
+			log.Printf("Restored %d sessions", restored)
+		}()
+	} else {
+		log.Println("GOHN_SESSION_KEY is not set, sessions will not survive restarts")
+	}
+	sessions.StartCleanup(time.Hour)
+
+	userState, err = state.NewStore("data/state")
+	if err != nil {
+		log.Fatalf("Failed to initialize user state: %v", err)
+	}
+	client.AddBackgroundJob(5*time.Minute, refreshInboxes)
+	client.AddBackgroundJob(30*time.Minute, syncUserLists)
+}
+
+// Import the favorites, upvoted and hidden items of everyone who is logged in
+func syncUserLists() {
+	for _, account := range sessions.Accounts() {
+		syncAccountLists(account)
+	}
+}
+
+// Import the account's lists, logging how it went
+func syncAccountLists(account *hn.Account) {
+	imported, err := client.SyncUserLists(account, userState)
+	if err != nil {
+		log.Printf("Error importing lists: %v", err)
+	}
+	if imported > 0 {
+		log.Printf("Imported %d favorite, upvoted and hidden items of %s", imported, account.Username())
+	}
+}
+
+// Check the inboxes of everyone who is logged in for new replies
+func refreshInboxes() {
+	for _, username := range sessions.Usernames() {
+		if err := refreshInbox(username); err != nil {
+			log.Printf("Error refreshing inbox for %s: %v", username, err)
+		}
+	}
+}
+
+// Add replies to the user's latest items that aren't in their inbox yet
+func refreshInbox(username string) error {
+	replies, err := client.FindReplies(username, inboxSubmissions)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]state.Reply, 0, len(replies))
+	for _, reply := range replies {
+		entry := state.Reply{
+			ID:       reply.Item.ID,
+			By:       reply.Item.By,
+			Time:     reply.Item.Time,
+			Text:     reply.Item.Text,
+			ParentID: reply.Parent.ID,
+		}
+		if reply.Parent.Type == "story" {
+			entry.ParentTitle = reply.Parent.Title
+		} else {
+			entry.ParentText = reply.Parent.Text
+		}
+		entries = append(entries, entry)
+	}
+
+	return userState.Update(username, func(u *state.User) {
+		u.Inbox.Merge(entries, time.Now())
+	})
+}
+
+// Build the index and cache retention policy from the configuration
+func retentionPolicy(cfg *config.Config) hn.RetentionPolicy {
+	maxAge := make(map[string]time.Duration, len(cfg.RetentionDays))
+	for itemType, days := range cfg.RetentionDays {
+		maxAge[itemType] = time.Duration(days) * 24 * time.Hour
+	}
+
+	return hn.RetentionPolicy{
+		RetentionPolicy: search.RetentionPolicy{
+			MaxAge:    maxAge,
+			BatchSize: cfg.RetentionBatchSize,
+		},
+		PageCacheMaxAge: time.Duration(cfg.PageCacheDays) * 24 * time.Hour,
+		Interval:        cfg.RetentionInterval,
+		KeepFavorites:   cfg.KeepFavorites,
+		Favorites: func() (map[int]bool, error) {
+			return userState.Favorites()
+		},
+	}
 }
 
 // Get item from search index or fetch from HN API
 func getItem(id int) (*types.Item, error) {
-	// Try to get from search index first
+	// Try to get from search index first, unless it only has Algolia's copy
 	searchableItem, err := searchIndex.GetItem(id)
-	if err == nil {
+	if err == nil && !searchableItem.Approximate {
 		// Convert SearchableItem back to types.Item
 		return &types.Item{
 			ID:          searchableItem.ID,
@@ -130,8 +271,9 @@ func getItem(id int) (*types.Item, error) {
 			Title:       searchableItem.Title,
 			Descendants: searchableItem.Descendants,
 			Rank:        searchableItem.Rank,
-			VoteDir:     searchableItem.VoteDir,
 			Kids:        searchableItem.Kids,
+			Dead:        searchableItem.Dead,
+			Deleted:     searchableItem.Deleted,
 		}, nil
 	}
 
@@ -200,14 +342,96 @@ func getMenuState(r *http.Request) string {
 	return cookie.Value
 }
 
+// Get the HN account acting for this request, or nil if the browser has no session
+func currentAccount(r *http.Request) *hn.Account {
+	sess := sessions.Get(r)
+	if sess == nil {
+		return nil
+	}
+	return sess.Account
+}
+
+// Find an item on an item page, or nil if it isn't there
+func findItem(page *hn.ItemPage, id int) *types.Item {
+	if page == nil {
+		return nil
+	}
+	if page.Item != nil && page.Item.ID == id {
+		return page.Item
+	}
+	if node := page.FindComment(id); node != nil {
+		return node.Item
+	}
+	return nil
+}
+
+// Pick a page of replies and cut them off after threadDepth levels, returning
+// them with the number of replies after that page
+func threadPage(nodes []*hn.CommentNode, page int) ([]*hn.CommentNode, int) {
+	start := min((page-1)*threadsPerPage, len(nodes))
+	end := min(start+threadsPerPage, len(nodes))
+	return hn.PruneThread(nodes[start:end], threadDepth), len(nodes) - end
+}
+
 // Helper function to create template data with common fields
 func createTemplateData(title string, content string, r *http.Request) map[string]interface{} {
+	account := currentAccount(r)
+
+	unread := 0
+	var commentCounts map[int]int
+	var flags map[int]state.Flags
+	if username := account.Username(); username != "" {
+		userState.View(username, func(u *state.User) {
+			unread = u.Inbox.Unread()
+			commentCounts = u.CommentCounts()
+			flags = u.ItemFlags()
+		})
+	}
+
 	return map[string]interface{}{
-		"Title":     title,
-		"Content":   content,
-		"Theme":     getTheme(r),
-		"MenuState": getMenuState(r),
+		"Title":         title,
+		"Content":       content,
+		"Theme":         getTheme(r),
+		"MenuState":     getMenuState(r),
+		"LoggedIn":      account.IsLoggedIn(),
+		"Username":      account.Username(),
+		"Unread":        unread,
+		"CommentCounts": commentCounts,
+		"Flags":         flags,
+	}
+}
+
+// Look up what the user upvoted, favorited and hid on HN, by item ID
+func itemFlags(username string) map[int]state.Flags {
+	var flags map[int]state.Flags
+	if username != "" {
+		userState.View(username, func(u *state.User) {
+			flags = u.ItemFlags()
+		})
+	}
+	return flags
+}
+
+// Look up the user's latest visit of an item: when it was, zero if they
+// haven't been there, and which comments they had seen
+func seenComments(username string, itemID int) (time.Time, map[int]bool) {
+	var last time.Time
+	seen := make(map[int]bool)
+	if username == "" {
+		return last, seen
 	}
+
+	userState.View(username, func(u *state.User) {
+		visit := u.Visit(itemID)
+		if visit == nil {
+			return
+		}
+		last = visit.Time
+		for _, id := range visit.Seen {
+			seen[id] = true
+		}
+	})
+	return last, seen
 }
 
 func main() {
@@ -222,13 +446,6 @@ func main() {
 	}
 	log.Println("Templates parsed successfully")
 
-	// Create HN client
-	client, err := hn.NewClient()
-	if err != nil {
-		log.Fatalf("Error creating HN client: %v", err)
-	}
-	log.Println("HN client created successfully")
-
 	// Create a custom server with timeouts
 	server := &http.Server{
 		Addr:           ":8080",
@@ -256,7 +473,6 @@ func main() {
 		validSections := map[string]bool{
 			"topstories":  true,
 			"newstories":  true,
-			"paststories": true,
 			"askstories":  true,
 			"showstories": true,
 			"jobstories":  true,
@@ -305,7 +521,6 @@ func main() {
 			data["Page"] = page
 			data["NextPage"] = page + 1
 			data["MoreLink"] = end < len(comments)
-			data["LoggedIn"] = client.IsLoggedIn()
 
 			var templateErr error
 			if r.Header.Get("HX-Request") == "true" {
@@ -349,17 +564,19 @@ func main() {
 		log.Printf("Fetching %s (page: %d, perPage: %d)", section, page, perPage)
 
 		// Get stories for this page
-		stories, err := client.GetStoriesPage(section, page, perPage, false)
+		storiesPage, err := client.GetStoriesPage(section, page, perPage, false)
 		if err != nil {
 			log.Printf("Error fetching stories: %v", err)
 			http.Error(w, "Failed to load stories", http.StatusInternalServerError)
 			return
 		}
+		stories := storiesPage.Stories
 
 		log.Printf("Retrieved %d total stories", len(stories))
 
 		data := createTemplateData("Hacker News", "stories-list", r)
 		data["Stories"] = stories
+		data["Degraded"] = storiesPage.Degraded
 		data["Page"] = page
 		data["NextPage"] = page + 1
 		data["MoreLink"] = len(stories) == perPage
@@ -385,7 +602,9 @@ func main() {
 		log.Printf("Successfully rendered page with %d stories", len(stories))
 	})
 
-	// Item/Comments page
+	// Item/Comments page. It is sent in parts: the item as soon as it is
+	// known, then each thread as soon as it has been fetched, so cold threads
+	// start showing right away instead of after the whole tree is in.
 	http.HandleFunc("/item/", func(w http.ResponseWriter, r *http.Request) {
 		id, err := strconv.Atoi(r.URL.Path[6:])
 		if err != nil {
@@ -393,19 +612,295 @@ func main() {
 			return
 		}
 
-		// Get the item page from cache or fetch it
-		page, err := client.GetItemPage(id, false)
+		// Fetching a cold thread can take longer than the server's WriteTimeout
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Now().Add(time.Minute))
+
+		// Comments the user didn't see on their last visit are marked new
+		username := currentAccount(r).Username()
+		lastVisit, seen := seenComments(username, id)
+		isNew := func(commentID int) bool {
+			return !lastVisit.IsZero() && !seen[commentID]
+		}
+
+		// The page is already on its way when a part fails to render, so the
+		// error can only be logged
+		render := func(name string, data interface{}) {
+			if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+				log.Printf("Error rendering %s of %d: %v", name, id, err)
+			}
+		}
+
+		var data map[string]interface{}
+		start := func(item *types.Item) {
+			data = createTemplateData(item.Title, "", r)
+			data["Item"] = item
+			// A comment's page shows where it sits in its thread
+			if item.Type == "comment" {
+				if thread, err := client.GetCommentContext(item); err == nil {
+					data["Context"] = thread
+					data["Title"] = fmt.Sprintf("Comment by %s on %s", item.By, thread.Root.Title)
+				} else {
+					log.Printf("Error finding the thread of comment %d: %v", item.ID, err)
+				}
+			}
+			if sess := sessions.Get(r); sess != nil {
+				data["Draft"] = sess.Draft(item.ID)
+			}
+			if !lastVisit.IsZero() {
+				data["LastVisit"] = int(lastVisit.Unix())
+			}
+
+			render("header", data)
+			render("item-head", data)
+			rc.Flush()
+		}
+
+		sent := 0
+		var shown []int
+		emit := func(node *hn.CommentNode) {
+			// The threads after the first page are loaded from /threads/
+			if sent == threadsPerPage {
+				return
+			}
+			sent++
+
+			nodes := hn.PruneThread([]*hn.CommentNode{node}, threadDepth)
+			shown = append(shown, hn.ThreadIDs(nodes)...)
+			hn.MarkNew(nodes, isNew)
+			render("comment", map[string]interface{}{
+				"Node":     nodes[0],
+				"Root":     id,
+				"LoggedIn": data["LoggedIn"],
+				"Username": data["Username"],
+				"Flags":    data["Flags"],
+				"Reveal":   true,
+			})
+			rc.Flush()
+		}
+
+		// Nothing has been sent when this fails
+		page, err := client.StreamItemPage(id, start, emit)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		data := createTemplateData(page.Item.Title, "comments-content", r)
-		data["Item"] = page.Item
-		data["Comments"] = page.Comments
-		data["LoggedIn"] = client.IsLoggedIn()
+		// Only what was shown counts as seen. The replies loaded later are
+		// added as they come in, so the visit is recorded before the page
+		// can ask for them.
+		if username != "" {
+			err := userState.Update(username, func(u *state.User) {
+				u.RecordVisit(id, shown, page.Item.Descendants, time.Now())
+			})
+			if err != nil {
+				log.Printf("Error recording visit of %d for %s: %v", id, username, err)
+			}
+		}
 
-		tmpl.ExecuteTemplate(w, "base", data)
+		_, remaining := threadPage(page.Comments, 1)
+		render("replies-more", map[string]interface{}{
+			"ID":         id,
+			"Root":       id,
+			"Depth":      0,
+			"Page":       1,
+			"Remaining":  remaining,
+			"Incomplete": page.Incomplete,
+			"Reveal":     true,
+		})
+		render("item-foot", data)
+		render("footer", data)
+	})
+
+	// How many comments of a thread are new since the user's previous visit,
+	// loaded once the page has recorded the current one. Those that weren't
+	// shown yet count as long as they weren't seen before.
+	http.HandleFunc("/new-comments/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Path[len("/new-comments/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		data := map[string]interface{}{}
+		username := currentAccount(r).Username()
+		if username != "" {
+			var visit state.Visit
+			userState.View(username, func(u *state.User) {
+				if v := u.Visit(id); v != nil {
+					visit = *v
+				}
+			})
+			if !visit.Prev.IsZero() {
+				count := len(visit.New)
+				if page, ok := client.CachedItemPage(id); ok {
+					seen := make(map[int]bool, len(visit.Seen))
+					for _, commentID := range visit.Seen {
+						seen[commentID] = true
+					}
+					for _, commentID := range page.CommentIDs() {
+						if !seen[commentID] {
+							count++
+						}
+					}
+				}
+				data["NewCount"] = count
+				data["LastVisit"] = int(visit.Prev.Unix())
+			}
+		}
+
+		if err := tmpl.ExecuteTemplate(w, "new-comments", data); err != nil {
+			log.Printf("Error rendering new comments of %d: %v", id, err)
+		}
+	})
+
+	// Preview of an item, shown when hovering a link to it in a comment
+	http.HandleFunc("/preview/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Path[len("/preview/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Comes from the index when the item was fetched before
+		item, err := client.GetItem(id)
+		if err != nil {
+			log.Printf("Error fetching preview of %d: %v", id, err)
+			http.Error(w, "Failed to load item", http.StatusInternalServerError)
+			return
+		}
+
+		// Let the browser keep it while the reader is on the page
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		tmpl.ExecuteTemplate(w, "item-preview", item)
+	})
+
+	// Earlier discussions of a story's link, which its page asks for once it
+	// has loaded
+	http.HandleFunc("/discussions/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Path[len("/discussions/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		discussions, err := client.GetDiscussions(id)
+		if err != nil {
+			log.Printf("Error finding earlier discussions of %d: %v", id, err)
+		}
+
+		tmpl.ExecuteTemplate(w, "discussions", map[string]interface{}{
+			"Discussions": discussions,
+		})
+	})
+
+	// Domain page - stories submitted from a single site
+	http.HandleFunc("/from", func(w http.ResponseWriter, r *http.Request) {
+		site := r.URL.Query().Get("site")
+		if site == "" {
+			http.Error(w, "Missing site", http.StatusBadRequest)
+			return
+		}
+
+		page := 1
+		if pageStr := r.URL.Query().Get("p"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
+		}
+
+		var cursor hn.DomainCursor
+		if next := r.URL.Query().Get("next"); next != "" {
+			var err error
+			cursor, err = hn.ParseDomainCursor(next)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+		}
+
+		domainPage, err := client.GetDomainPage(site, cursor, page, 30)
+		if err != nil {
+			log.Printf("Error fetching stories from %s: %v", site, err)
+			http.Error(w, "Failed to load stories", http.StatusInternalServerError)
+			return
+		}
+
+		data := createTemplateData(domainPage.Site, "from-content", r)
+		data["Site"] = domainPage.Site
+		data["Stories"] = domainPage.Stories
+		data["Stats"] = domainPage.Stats
+		data["Page"] = page
+		data["NextPage"] = page + 1
+		data["Next"] = domainPage.Next.String()
+		data["MoreLink"] = domainPage.HasMore
+
+		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		}
+	})
+
+	// Past front pages by day
+	http.HandleFunc("/paststories", func(w http.ResponseWriter, r *http.Request) {
+		// Like HN's /front, default to yesterday
+		day := time.Now().UTC().AddDate(0, 0, -1)
+		if dayStr := r.URL.Query().Get("day"); dayStr != "" {
+			parsed, err := time.Parse(hn.DayFormat, dayStr)
+			if err != nil || parsed.After(time.Now()) {
+				http.Error(w, "Invalid day", http.StatusBadRequest)
+				return
+			}
+			day = parsed
+		}
+
+		frontPage, err := client.GetFrontPage(day)
+		if err != nil {
+			log.Printf("Error fetching front page for %s: %v", day.Format(hn.DayFormat), err)
+			http.Error(w, "Failed to load stories", http.StatusInternalServerError)
+			return
+		}
+
+		today := time.Now().UTC().Format(hn.DayFormat)
+		next := day.AddDate(0, 0, 1).Format(hn.DayFormat)
+
+		data := createTemplateData("Front page for "+frontPage.Day, "past-content", r)
+		data["Section"] = "paststories"
+		data["Day"] = frontPage.Day
+		data["DayTitle"] = day.Format("Monday, January 2, 2006")
+		data["PrevDay"] = day.AddDate(0, 0, -1).Format(hn.DayFormat)
+		data["Today"] = today
+		if next <= today {
+			data["NextDay"] = next
+		}
+		data["Stories"] = frontPage.Stories
+		data["Source"] = frontPage.Source
+
+		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		}
+	})
+
+	// Autocomplete suggestions for the search box
+	http.HandleFunc("/autocomplete", func(w http.ResponseWriter, r *http.Request) {
+		// Suggestions are only useful if they arrive while the user is typing
+		ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
+		defer cancel()
+
+		suggestions, err := searchIndex.Suggest(ctx, r.URL.Query().Get("q"), 10)
+		if err != nil {
+			log.Printf("Error fetching suggestions: %v", err)
+			http.Error(w, "Failed to load suggestions", http.StatusInternalServerError)
+			return
+		}
+
+		data := map[string]interface{}{
+			"Suggestions": suggestions,
+		}
+		if err := tmpl.ExecuteTemplate(w, "suggestions", data); err != nil {
+			log.Printf("Template error: %v", err)
+		}
 	})
 
 	// User profile page
@@ -423,6 +918,45 @@ func main() {
 		tmpl.ExecuteTemplate(w, "base", data)
 	})
 
+	// Replies to the user's comments and stories
+	http.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		username := currentAccount(r).Username()
+		if username == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// The background job only runs every few minutes
+		var lastChecked time.Time
+		userState.View(username, func(u *state.User) {
+			lastChecked = u.Inbox.LastChecked
+		})
+		if time.Since(lastChecked) > time.Minute {
+			if err := refreshInbox(username); err != nil {
+				log.Printf("Error refreshing inbox for %s: %v", username, err)
+			}
+		}
+
+		// Show which replies are new, then mark them read
+		var replies []state.Reply
+		err := userState.Update(username, func(u *state.User) {
+			replies = append(replies, u.Inbox.Replies...)
+			u.Inbox.MarkAllRead()
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := createTemplateData("Inbox", "inbox-content", r)
+		data["Replies"] = replies
+
+		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		}
+	})
+
 	// Login handler
 	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
@@ -434,12 +968,47 @@ func main() {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		if err := client.Login(username, password); err != nil {
-			data := createTemplateData("Login", err.Error(), r)
+		// Every login gets a fresh account, so cookies never leak between users
+		account, err := client.NewAccount()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := account.Login(username, password); err != nil {
+			data := createTemplateData("Login", "login-content", r)
+			data["Error"] = err.Error()
 			tmpl.ExecuteTemplate(w, "base", data)
 			return
 		}
 
+		if _, err := sessions.Create(w, r, account); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Start importing right away rather than at the next scheduled run
+		go syncAccountLists(account)
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	// Logout handler
+	http.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// End the session on HN too, so its cookie can't be reused
+		if account := currentAccount(r); account != nil {
+			username := account.Username()
+			if err := account.Logout(); err != nil {
+				log.Printf("Error logging %s out of HN: %v", username, err)
+			}
+		}
+
+		sessions.Destroy(w, r)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	})
 
@@ -453,15 +1022,60 @@ func main() {
 
 		title := r.FormValue("title")
 		url := r.FormValue("url")
+		text := r.FormValue("text")
 
-		id, err := client.SubmitStory(title, url)
-		if err != nil {
-			data := createTemplateData("Submit", err.Error(), r)
+		// Re-render the form with what the user entered
+		renderForm := func(data map[string]interface{}) {
+			data["FormTitle"] = title
+			data["FormURL"] = url
+			data["FormText"] = text
 			tmpl.ExecuteTemplate(w, "base", data)
+		}
+
+		// Warn before reposting an article that has already been discussed,
+		// unless the user has seen the warning and confirmed
+		if url != "" && r.FormValue("confirm") == "" {
+			discussions, err := client.FindDiscussions(url, 0)
+			if err != nil {
+				log.Printf("Error checking for duplicates of %s: %v", url, err)
+			}
+			if len(discussions) > 0 {
+				data := createTemplateData("Submit", "submit-content", r)
+				data["Discussions"] = discussions
+				renderForm(data)
+				return
+			}
+		}
+
+		account := currentAccount(r)
+		if !account.IsLoggedIn() {
+			data := createTemplateData("Submit", "submit-content", r)
+			data["Error"] = "you must be logged in to submit a story"
+			renderForm(data)
+			return
+		}
+
+		result, err := account.SubmitStory(title, url, text)
+		if err != nil {
+			data := createTemplateData("Submit", "submit-content", r)
+			data["Error"] = err.Error()
+			renderForm(data)
+			return
+		}
+
+		if result.Status != hn.SubmitCreated {
+			data := createTemplateData("Submit", "submit-content", r)
+			data["Result"] = result
+			renderForm(data)
 			return
 		}
 
-		http.Redirect(w, r, fmt.Sprintf("/item/%d", id), http.StatusSeeOther)
+		// The new story's ID isn't always known, but it will be at the top of new
+		if result.ItemID == 0 {
+			http.Redirect(w, r, "/newstories", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/item/%d", result.ItemID), http.StatusSeeOther)
 	})
 
 	// Theme toggle handler
@@ -536,7 +1150,7 @@ func main() {
 		w.Header().Set("Content-Type", "text/html")
 		menuHTML := `<div id="mobile-menu" class="nav-links %s">
 			<a href="/newest">new</a>
-			<a href="/front">past</a>
+			<a href="/paststories">past</a>
 			<a href="/newcomments">comments</a>
 			<a href="/ask">ask</a>
 			<a href="/show">show</a>
@@ -560,7 +1174,8 @@ func main() {
 
 	// Comment reply handler
 	http.HandleFunc("/reply/", func(w http.ResponseWriter, r *http.Request) {
-		if !client.IsLoggedIn() {
+		sess := sessions.Get(r)
+		if sess == nil || !sess.Account.IsLoggedIn() {
 			http.Error(w, "Must be logged in to reply", http.StatusUnauthorized)
 			return
 		}
@@ -581,11 +1196,248 @@ func main() {
 		data := map[string]interface{}{
 			"ParentID": id,
 			"Parent":   parent,
+			"Text":     sess.Draft(id),
 		}
 
 		tmpl.ExecuteTemplate(w, "reply-form", data)
 	})
 
+	// Render a page of the replies to an item of root's thread. They come
+	// from root's cached page when it has them, and are fetched otherwise.
+	// Building root's page here would start a whole thread build for every
+	// batch of replies that scrolls into view.
+	serveReplies := func(w http.ResponseWriter, r *http.Request, id, root, depth int) {
+		pageNum, err := strconv.Atoi(r.URL.Query().Get("p"))
+		if err != nil || pageNum < 1 {
+			pageNum = 1
+		}
+
+		var replies []*hn.CommentNode
+		complete := false
+		if page, ok := client.CachedItemPage(root); ok {
+			if id == root {
+				replies, complete = page.Comments, !page.Incomplete
+			} else if node := page.FindComment(id); node != nil && !node.Incomplete {
+				replies, complete = node.Children, true
+			}
+		}
+		if !complete {
+			replies, complete, err = client.GetReplies(id, depth)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		replies, remaining := threadPage(replies, pageNum)
+		account := currentAccount(r)
+
+		// The page these replies are loaded into has already recorded the
+		// visit, to which they are added as shown
+		fresh := make(map[int]bool)
+		if username := account.Username(); username != "" {
+			err := userState.Update(username, func(u *state.User) {
+				for _, commentID := range u.RecordSeen(root, hn.ThreadIDs(replies)) {
+					fresh[commentID] = true
+				}
+			})
+			if err != nil {
+				log.Printf("Error recording replies of %d seen by %s: %v", root, username, err)
+			}
+		}
+		hn.MarkNew(replies, func(commentID int) bool { return fresh[commentID] })
+		data := map[string]interface{}{
+			"ID":         id,
+			"Root":       root,
+			"Depth":      depth,
+			"Page":       pageNum,
+			"Replies":    replies,
+			"Remaining":  remaining,
+			"Incomplete": !complete,
+			"LoggedIn":   account.IsLoggedIn(),
+			"Username":   account.Username(),
+			"Flags":      itemFlags(account.Username()),
+		}
+
+		tmpl.ExecuteTemplate(w, "replies", data)
+	}
+
+	// Replies below a comment, for branches that were cut off or couldn't be
+	// fetched in time when their page was built. The page asks for the latter
+	// as they scroll into view, while the replies served here only retry on
+	// click so ones that keep failing don't loop.
+	http.HandleFunc("/replies/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Path[len("/replies/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+		root, err := strconv.Atoi(r.URL.Query().Get("root"))
+		if err != nil {
+			root = id
+		}
+		depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+
+		serveReplies(w, r, id, root, depth)
+	})
+
+	// Further pages of the threads below a story
+	http.HandleFunc("/threads/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Path[len("/threads/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		serveReplies(w, r, id, id, 0)
+	})
+
+	// Autosave of the comment being typed, so it survives a failed post
+	http.HandleFunc("/draft", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sess := sessions.Get(r)
+		if sess == nil || !sess.Account.IsLoggedIn() {
+			http.Error(w, "Must be logged in to save drafts", http.StatusUnauthorized)
+			return
+		}
+
+		parentID, err := strconv.Atoi(r.FormValue("parent_id"))
+		if err != nil {
+			http.Error(w, "Invalid parent ID", http.StatusBadRequest)
+			return
+		}
+
+		sess.SaveDraft(parentID, r.FormValue("text"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Edit and delete links for the user's own items, shown only while HN offers them
+	http.HandleFunc("/edit-links/", func(w http.ResponseWriter, r *http.Request) {
+		account := currentAccount(r)
+		if !account.IsLoggedIn() {
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Path[len("/edit-links/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		canEdit, canDelete, err := account.EditOptions(id)
+		if err != nil {
+			log.Printf("Error checking edit links for %d: %v", id, err)
+			return
+		}
+
+		isStory := false
+		if item, err := getItem(id); err == nil {
+			isStory = item.Type == "story"
+		}
+
+		tmpl.ExecuteTemplate(w, "edit-links", map[string]interface{}{
+			"ID":        id,
+			"CanEdit":   canEdit,
+			"CanDelete": canDelete,
+			"IsStory":   isStory,
+		})
+	})
+
+	// Inline editing of the user's own items
+	http.HandleFunc("/edit/", func(w http.ResponseWriter, r *http.Request) {
+		account := currentAccount(r)
+		if !account.IsLoggedIn() {
+			http.Error(w, "Must be logged in to edit", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Path[len("/edit/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		item, err := getItem(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := map[string]interface{}{
+			"ID":       id,
+			"Original": item.Text,
+		}
+
+		if r.Method == "GET" {
+			text, err := account.EditText(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			data["Text"] = text
+			tmpl.ExecuteTemplate(w, "edit-form", data)
+			return
+		}
+
+		text := r.FormValue("text")
+		if err := account.Edit(id, text); err != nil {
+			// Keep the form open with what the user typed
+			data["Text"] = text
+			data["Error"] = err.Error()
+			tmpl.ExecuteTemplate(w, "edit-form", data)
+			return
+		}
+
+		page, err := client.RefreshItem(id)
+		if err != nil {
+			log.Printf("Error refreshing item %d after edit: %v", id, err)
+		}
+		if edited := findItem(page, id); edited != nil {
+			item = edited
+		}
+
+		tmpl.ExecuteTemplate(w, "item-text", item)
+	})
+
+	// Deleting the user's own items
+	http.HandleFunc("/delete/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		account := currentAccount(r)
+		if !account.IsLoggedIn() {
+			http.Error(w, "Must be logged in to delete", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Path[len("/delete/"):])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := account.Delete(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		page, err := client.RefreshItem(id)
+		if err != nil {
+			log.Printf("Error refreshing item %d after delete: %v", id, err)
+		}
+
+		// A deleted story has no page left to show
+		if page == nil || page.Item.ID == id {
+			w.Header().Set("HX-Redirect", "/")
+		}
+	})
+
 	// Comment submit handler
 	http.HandleFunc("/comment", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -593,7 +1445,8 @@ func main() {
 			return
 		}
 
-		if !client.IsLoggedIn() {
+		sess := sessions.Get(r)
+		if sess == nil || !sess.Account.IsLoggedIn() {
 			http.Error(w, "Must be logged in to comment", http.StatusUnauthorized)
 			return
 		}
@@ -604,27 +1457,75 @@ func main() {
 			return
 		}
 
+		// Keep the text before trying, so nothing is lost if posting fails
 		text := r.FormValue("text")
-		if text == "" {
-			http.Error(w, "Comment text cannot be empty", http.StatusBadRequest)
+		sess.SaveDraft(parentID, text)
+
+		// Show the form again with the text and what went wrong
+		renderForm := func(message string) {
+			data := map[string]interface{}{
+				"ParentID": parentID,
+				"Text":     text,
+				"Error":    message,
+			}
+			if parent, err := getItem(parentID); err == nil {
+				data["TopLevel"] = parent.Type != "comment"
+			}
+			tmpl.ExecuteTemplate(w, "comment-form", data)
+		}
+
+		if strings.TrimSpace(text) == "" {
+			renderForm("Comment text cannot be empty")
 			return
 		}
 
-		err = client.Comment(parentID, text)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := sess.Account.Comment(parentID, text); err != nil {
+			renderForm(err.Error())
 			return
 		}
+		sess.DeleteDraft(parentID)
+
+		// Rebuild the story's page so the new comment shows up on it
+		target := fmt.Sprintf("/item/%d", parentID)
+		if page, err := client.RefreshItem(parentID); err == nil {
+			target = fmt.Sprintf("/item/%d", page.Item.ID)
+		} else {
+			log.Printf("Error refreshing item %d after commenting: %v", parentID, err)
+		}
 
-		// Redirect to the item page
-		http.Redirect(w, r, fmt.Sprintf("/item/%d", parentID), http.StatusSeeOther)
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", target)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
 	})
 
+	// Shut down cleanly on interrupt so queued index writes are flushed
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
 	// Start server
 	log.Println("Server starting on http://localhost:8080")
-	if err := server.ListenAndServe(); err != nil {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
+
+	client.StopBackgroundJobs()
+	sessions.Stop()
+	if err := searchIndex.Close(); err != nil {
+		log.Printf("Error closing search index: %v", err)
+	}
+	log.Println("Server stopped")
 }
 
 // Helper function to recursively fetch child comments
@@ -0,0 +1,339 @@
+package render
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// minLanguageScore is how sure detectLanguage must be before a code block
+// is highlighted at all
+const minLanguageScore = 4
+
+// language describes enough of a programming language to highlight it
+type language struct {
+	name     string
+	keywords []string
+	// upperKeywords is set for languages written in any case whose keywords
+	// are listed in upper case. Only upper case ones count when detecting.
+	upperKeywords bool
+	lineComments  []string
+	blockComment  [2]string
+	// quotes are the characters strings start and end with
+	quotes string
+	// markers are snippets that hardly appear in other languages
+	markers []string
+}
+
+var languages = []*language{
+	{
+		name: "go",
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else",
+			"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package",
+			"range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		markers:      []string{"func ", ":= ", "package ", "fmt.", "err != nil", "chan "},
+	},
+	{
+		name: "python",
+		keywords: []string{"def", "class", "return", "if", "elif", "else", "for", "while", "in",
+			"not", "and", "or", "is", "None", "True", "False", "import", "from", "as", "with", "try",
+			"except", "finally", "raise", "lambda", "yield", "pass", "break", "continue", "self",
+			"async", "await", "global"},
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+		markers:      []string{"def ", "elif ", "self.", "print(", "__init__", "None", "):\n"},
+	},
+	{
+		name: "javascript",
+		keywords: []string{"function", "const", "let", "var", "return", "if", "else", "for", "while",
+			"new", "this", "class", "extends", "import", "export", "from", "async", "await", "typeof",
+			"instanceof", "null", "undefined", "true", "false", "try", "catch", "throw", "switch",
+			"case", "default", "break", "continue"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		markers:      []string{"function", "=> ", "const ", "let ", "console.", "===", "document."},
+	},
+	{
+		name: "rust",
+		keywords: []string{"fn", "let", "mut", "impl", "struct", "enum", "trait", "pub", "use", "mod",
+			"match", "if", "else", "for", "while", "loop", "return", "self", "Self", "true", "false",
+			"as", "where", "crate", "unsafe", "move", "ref"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+		markers:      []string{"fn ", "let mut ", "impl ", "&mut ", "println!", "Option<", "Result<"},
+	},
+	{
+		// C and the languages that look like it, such as C++ and Java
+		name: "c",
+		keywords: []string{"int", "char", "void", "return", "if", "else", "for", "while", "struct",
+			"typedef", "static", "const", "unsigned", "long", "double", "float", "sizeof", "switch",
+			"case", "break", "continue", "default", "public", "private", "class", "new", "this",
+			"null", "true", "false", "template", "namespace"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+		markers:      []string{"#include", "int main", "printf(", "std::", "public static", "->"},
+	},
+	{
+		name: "shell",
+		keywords: []string{"echo", "cd", "export", "if", "then", "fi", "for", "do", "done", "else",
+			"elif", "case", "esac", "while", "function", "local", "sudo"},
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+		markers:      []string{"$ ", "#!/bin", "sudo ", "| grep", "apt-get ", "echo "},
+	},
+	{
+		name: "sql",
+		keywords: []string{"SELECT", "FROM", "WHERE", "INSERT", "INTO", "UPDATE", "DELETE", "CREATE",
+			"TABLE", "JOIN", "ON", "GROUP", "BY", "ORDER", "HAVING", "AND", "OR", "NOT", "NULL", "AS",
+			"VALUES", "SET", "INDEX", "PRIMARY", "KEY", "INNER", "LEFT", "RIGHT", "LIMIT", "DISTINCT"},
+		upperKeywords: true,
+		lineComments:  []string{"--"},
+		blockComment:  [2]string{"/*", "*/"},
+		quotes:        "'\"",
+		markers:       []string{"SELECT ", "FROM ", "WHERE ", "INSERT INTO", "CREATE TABLE"},
+	},
+}
+
+// Text renders HN's HTML for a page: sanitized, with code blocks highlighted
+func Text(s string) string {
+	return highlight(Sanitize(s))
+}
+
+// highlight highlights the code in the <pre><code> blocks of s. Everything
+// else is passed through as it is, so s must come from Sanitize.
+func highlight(s string) string {
+	if !strings.Contains(s, "<pre><code>") {
+		return s
+	}
+
+	var b strings.Builder
+	afterPre := false
+	inCode := false
+	// The block as it came in, in case it isn't highlighted
+	var block strings.Builder
+	var code strings.Builder
+	plain := true
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		// Token unescapes text in place, which would change Raw
+		raw := string(z.Raw())
+		token := z.Token()
+
+		if inCode {
+			if tt == html.EndTagToken && token.Data == "code" {
+				inCode = false
+				var lang *language
+				if plain {
+					lang = detectLanguage(code.String())
+				}
+				if lang != nil {
+					b.WriteString(`<code class="language-` + lang.name + `">`)
+					b.WriteString(highlightCode(code.String(), lang))
+				} else {
+					b.WriteString("<code>")
+					b.WriteString(block.String())
+				}
+				b.WriteString("</code>")
+				continue
+			}
+			block.WriteString(raw)
+			if tt == html.TextToken {
+				code.WriteString(token.Data)
+			} else {
+				// Links and the like inside code are kept as they are
+				plain = false
+			}
+			continue
+		}
+
+		if tt == html.StartTagToken && token.Data == "code" && afterPre {
+			inCode = true
+			block.Reset()
+			code.Reset()
+			plain = true
+			continue
+		}
+		afterPre = tt == html.StartTagToken && token.Data == "pre"
+		b.WriteString(raw)
+	}
+
+	// Sanitize closes every tag, so a block is never left open
+	return b.String()
+}
+
+// detectLanguage guesses which language code is in, or returns nil if it
+// doesn't look enough like any of them
+func detectLanguage(code string) *language {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(code, func(r rune) bool { return !isWordChar(r) }) {
+		words[word] = true
+	}
+
+	var best *language
+	bestScore := 0
+	for _, lang := range languages {
+		score := 0
+		for _, marker := range lang.markers {
+			if strings.Contains(code, marker) {
+				score += 3
+			}
+		}
+		for _, keyword := range lang.keywords {
+			if words[keyword] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+
+	if bestScore < minLanguageScore {
+		return nil
+	}
+	return best
+}
+
+// highlightCode escapes code and wraps its comments, strings, numbers,
+// keywords and function names in spans with an hl- class
+func highlightCode(code string, lang *language) string {
+	keywords := make(map[string]bool, len(lang.keywords))
+	for _, keyword := range lang.keywords {
+		keywords[keyword] = true
+	}
+
+	var b strings.Builder
+	span := func(class, text string) {
+		b.WriteString(`<span class="hl-` + class + `">` + html.EscapeString(text) + `</span>`)
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+
+		if open, end := lang.blockComment[0], lang.blockComment[1]; open != "" && strings.HasPrefix(rest, open) {
+			n := len(rest)
+			if j := strings.Index(rest[len(open):], end); j >= 0 {
+				n = len(open) + j + len(end)
+			}
+			span("comment", rest[:n])
+			i += n
+			continue
+		}
+
+		if lineComment(rest, lang) {
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			span("comment", rest[:n])
+			i += n
+			continue
+		}
+
+		c := rest[0]
+		switch {
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			n := stringLength(rest)
+			span("string", rest[:n])
+			i += n
+
+		case c >= '0' && c <= '9':
+			n := 1
+			for n < len(rest) && (isWordChar(rune(rest[n])) || rest[n] == '.') {
+				n++
+			}
+			span("number", rest[:n])
+			i += n
+
+		case isWordChar(rune(c)):
+			n := 1
+			for n < len(rest) && (isWordChar(rune(rest[n])) || rest[n] >= 0x80) {
+				n++
+			}
+			word := rest[:n]
+			keyword := word
+			if lang.upperKeywords {
+				keyword = strings.ToUpper(word)
+			}
+			switch {
+			case keywords[keyword]:
+				span("keyword", word)
+			case strings.HasPrefix(strings.TrimLeft(rest[n:], " "), "("):
+				span("function", word)
+			default:
+				b.WriteString(html.EscapeString(word))
+			}
+			i += n
+
+		default:
+			// Copy everything up to the next character that may start a token
+			n := 1
+			for n < len(rest) && !startsToken(rest[n:], lang) {
+				n++
+			}
+			b.WriteString(html.EscapeString(rest[:n]))
+			i += n
+		}
+	}
+
+	return b.String()
+}
+
+// lineComment reports whether s starts with one of the language's line comments
+func lineComment(s string, lang *language) bool {
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsToken reports whether s starts with something highlightCode treats
+// specially
+func startsToken(s string, lang *language) bool {
+	c := s[0]
+	return isWordChar(rune(c)) || strings.IndexByte(lang.quotes, c) >= 0 ||
+		(lang.blockComment[0] != "" && strings.HasPrefix(s, lang.blockComment[0])) ||
+		lineComment(s, lang)
+}
+
+// stringLength returns the length of the string literal s starts with. Only
+// triple-quoted strings and backquoted ones go past the end of the line.
+func stringLength(s string) int {
+	quote := s[0]
+	if triple := strings.Repeat(string(quote), 3); strings.HasPrefix(s, triple) {
+		if j := strings.Index(s[3:], triple); j >= 0 {
+			return 3 + j + 3
+		}
+		return len(s)
+	}
+
+	for n := 1; n < len(s); n++ {
+		switch {
+		case s[n] == '\\':
+			n++
+		case s[n] == quote:
+			return n + 1
+		case s[n] == '\n' && quote != '`':
+			return n
+		}
+	}
+	return len(s)
+}
+
+// isWordChar reports whether r can be part of an identifier or keyword
+func isWordChar(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// usernameRe matches the usernames HN allows
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// linkTag returns the opening tag for a link to href, which must be safe.
+// Links to HN items and users go to the local pages instead, and item links
+// load a preview of the item when hovered.
+func linkTag(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.Host != "news.ycombinator.com" {
+		return `<a href="` + html.EscapeString(href) + `" rel="nofollow">`
+	}
+
+	id := u.Query().Get("id")
+	switch strings.TrimSuffix(u.Path, "/") {
+	case "/item":
+		if itemID, err := strconv.Atoi(id); err == nil && itemID > 0 {
+			return fmt.Sprintf(`<a href="/item/%d" class="hn-link" hx-get="/preview/%d" hx-trigger="mouseenter once" hx-swap="afterend">`, itemID, itemID)
+		}
+	case "/user":
+		if usernameRe.MatchString(id) {
+			return `<a href="/user/` + id + `" class="hn-link">`
+		}
+	}
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow">`
+}
+
+// Excerpt returns the start of HN's HTML as plain text, cut off at the last
+// word that fits in max characters
+func Excerpt(s string, max int) string {
+	var words []string
+	length := 0
+	truncated := false
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for !truncated {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.TextToken {
+			continue
+		}
+		for _, word := range strings.Fields(string(z.Text())) {
+			if len(words) > 0 && length+len(word) > max {
+				truncated = true
+				break
+			}
+			words = append(words, word)
+			length += len(word) + 1
+		}
+	}
+
+	excerpt := strings.Join(words, " ")
+	if truncated {
+		excerpt += "…"
+	}
+	return excerpt
+}
@@ -0,0 +1,134 @@
+// Package render turns the HTML of Hacker News items and profiles into markup
+// that is safe to put on a page.
+package render
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the tags HN uses in item text and user profiles. Anything
+// else is shown as text.
+var allowedTags = map[string]bool{
+	"p":    true,
+	"i":    true,
+	"a":    true,
+	"pre":  true,
+	"code": true,
+}
+
+// Sanitize rewrites HN's HTML so only the tags in allowedTags remain, without
+// any attributes except a link's href, which must be an http or https URL.
+// Links get rel="nofollow", except those to HN items and users, which point
+// at the local pages instead. Everything else, including tags that aren't
+// allowed, is escaped, and tags left open are closed at the end.
+func Sanitize(s string) string {
+	var b strings.Builder
+	var open []string
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Input that ends inside a tag is left over; show it as text
+			b.WriteString(html.EscapeString(string(z.Raw())))
+			break
+		}
+
+		raw := string(z.Raw())
+		switch tt {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(string(z.Text())))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if !allowedTags[token.Data] {
+				b.WriteString(html.EscapeString(raw))
+				continue
+			}
+			switch {
+			case token.Data == "p":
+				// HN separates paragraphs with <p> and never closes them
+				b.WriteString("<p>")
+			case token.Data == "a" && contains(open, "a"):
+				// Nested links aren't valid; keep the text of the inner one
+			case tt == html.SelfClosingTagToken:
+				// <i/> and the like have no content
+			case token.Data == "a":
+				href, ok := safeURL(attr(token, "href"))
+				if !ok {
+					// Keep the link text but not the link
+					continue
+				}
+				b.WriteString(linkTag(href))
+				open = append(open, "a")
+			default:
+				b.WriteString("<" + token.Data + ">")
+				open = append(open, token.Data)
+			}
+
+		case html.EndTagToken:
+			token := z.Token()
+			if !allowedTags[token.Data] {
+				b.WriteString(html.EscapeString(raw))
+				continue
+			}
+			// Close whatever was opened inside it as well
+			if i := lastIndex(open, token.Data); i >= 0 {
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+			}
+
+		default:
+			// Comments and doctypes
+			b.WriteString(html.EscapeString(raw))
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+
+	return b.String()
+}
+
+// safeURL returns href if it is an absolute http or https URL
+func safeURL(href string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// attr returns the value of the token's attribute with the given name
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// contains reports whether tags has tag
+func contains(tags []string, tag string) bool {
+	return lastIndex(tags, tag) >= 0
+}
+
+// lastIndex returns the position of the last tag in tags, or -1
+func lastIndex(tags []string, tag string) int {
+	for i := len(tags) - 1; i >= 0; i-- {
+		if tags[i] == tag {
+			return i
+		}
+	}
+	return -1
+}
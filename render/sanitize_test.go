@@ -0,0 +1,234 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", `fish & chips`, `fish &amp; chips`},
+		{"hn markup", `<p>one <i>two</i><p>three`, `<p>one <i>two</i><p>three`},
+		{"code block", `<pre><code>  x &lt; y</code></pre>`, `<pre><code>  x &lt; y</code></pre>`},
+		{"link", `<a href="https://example.com/a?b=c&amp;d=e">x</a>`, `<a href="https://example.com/a?b=c&amp;d=e" rel="nofollow">x</a>`},
+		{"upper case link", `<A HREF="HTTPS://example.com">x</A>`, `<a href="https://example.com" rel="nofollow">x</a>`},
+
+		{"script", `<script>alert(1)</script>`, `&lt;script&gt;alert(1)&lt;/script&gt;`},
+		{"script in svg", `<svg><script>x</script></svg>`, `&lt;svg&gt;&lt;script&gt;x&lt;/script&gt;&lt;/svg&gt;`},
+		{"img onerror", `<img src=x onerror=alert(1)>`, `&lt;img src=x onerror=alert(1)&gt;`},
+		{"event handler", `<a href="http://e.com" onclick="alert(1)">x</a>`, `<a href="http://e.com" rel="nofollow">x</a>`},
+		{"style attribute", `<i style="color:red">x</i>`, `<i>x</i>`},
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, `x`},
+		{"javascript href with spaces", `<a href=" jAvAsCrIpT:alert(1)">x</a>`, `x`},
+		{"data href", `<a href="data:text/html,<script>x</script>">x</a>`, `x`},
+		{"relative href", `<a href="/item?id=1">x</a>`, `x`},
+		{"protocol relative href", `<a href="//e.com">x</a>`, `x`},
+		{"quote breaking href", `<a href="http://e.com/&quot;onmouseover=&quot;alert(1)">x</a>`, `<a href="http://e.com/%22onmouseover=%22alert%281%29" rel="nofollow">x</a>`},
+		{"comment", `<!-- <script> -->x`, `&lt;!-- &lt;script&gt; --&gt;x`},
+		{"doctype", `<!DOCTYPE html>x`, `&lt;!DOCTYPE html&gt;x`},
+		{"unclosed tag", `<i>open`, `<i>open</i>`},
+		{"unclosed nesting", `<pre><code>x`, `<pre><code>x</code></pre>`},
+		{"misnested", `<i><pre></i>x</pre>`, `<i><pre></pre></i>x`},
+		{"stray end tag", `x</i></code>`, `x`},
+		{"nested links", `<a href="http://a.com"><a href="http://b.com">x</a></a>`, `<a href="http://a.com" rel="nofollow">x</a>`},
+		{"unterminated tag", `a <b`, `a &lt;b`},
+		{"unterminated script", `a <script src="x`, `a &lt;script src=&#34;x`},
+		{"self closing", `<i/>x`, `x`},
+		{"paragraph end tag", `<p>x</p>`, `<p>x`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeHNLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"item",
+			`<a href="https://news.ycombinator.com/item?id=123">x</a>`,
+			`<a href="/item/123" class="hn-link" hx-get="/preview/123" hx-trigger="mouseenter once" hx-swap="afterend">x</a>`,
+		},
+		{
+			"item over http with extra parameters",
+			`<a href="http://news.ycombinator.com/item?id=123&amp;p=2">x</a>`,
+			`<a href="/item/123" class="hn-link" hx-get="/preview/123" hx-trigger="mouseenter once" hx-swap="afterend">x</a>`,
+		},
+		{"user", `<a href="https://news.ycombinator.com/user?id=pg">x</a>`, `<a href="/user/pg" class="hn-link">x</a>`},
+		{"invalid item ID", `<a href="https://news.ycombinator.com/item?id=abc">x</a>`, `<a href="https://news.ycombinator.com/item?id=abc" rel="nofollow">x</a>`},
+		{"negative item ID", `<a href="https://news.ycombinator.com/item?id=-1">x</a>`, `<a href="https://news.ycombinator.com/item?id=-1" rel="nofollow">x</a>`},
+		{"invalid username", `<a href="https://news.ycombinator.com/user?id=p&quot;g">x</a>`, `<a href="https://news.ycombinator.com/user?id=p&#34;g" rel="nofollow">x</a>`},
+		{"other page", `<a href="https://news.ycombinator.com/newest">x</a>`, `<a href="https://news.ycombinator.com/newest" rel="nofollow">x</a>`},
+		{"other host", `<a href="https://example.com/item?id=123">x</a>`, `<a href="https://example.com/item?id=123" rel="nofollow">x</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{`<p>one two</p>`, 20, `one two`},
+		{`one two three`, 7, `one two…`},
+		{`one&amp;two <i>three</i>`, 30, `one&two three`},
+		{`supercalifragilistic`, 5, `supercalifragilistic`},
+		{``, 10, ``},
+	}
+
+	for _, tt := range tests {
+		if got := Excerpt(tt.in, tt.max); got != tt.want {
+			t.Errorf("Excerpt(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"go",
+			"<pre><code>func main() {\n\tx := \"&lt;s&gt;\" // c\n\treturn nil\n}</code></pre>",
+			"<pre><code class=\"language-go\"><span class=\"hl-keyword\">func</span> <span class=\"hl-function\">main</span>() {\n" +
+				"\tx := <span class=\"hl-string\">&#34;&lt;s&gt;&#34;</span> <span class=\"hl-comment\">// c</span>\n" +
+				"\t<span class=\"hl-keyword\">return</span> <span class=\"hl-keyword\">nil</span>\n}</code></pre>",
+		},
+		{
+			"python",
+			"<pre><code>def f(self):\n    return None</code></pre>",
+			"<pre><code class=\"language-python\"><span class=\"hl-keyword\">def</span> <span class=\"hl-function\">f</span>(<span class=\"hl-keyword\">self</span>):\n" +
+				"    <span class=\"hl-keyword\">return</span> <span class=\"hl-keyword\">None</span></code></pre>",
+		},
+		{
+			"sql",
+			"<pre><code>SELECT a FROM b WHERE c = 'x';</code></pre>",
+			"<pre><code class=\"language-sql\"><span class=\"hl-keyword\">SELECT</span> a <span class=\"hl-keyword\">FROM</span> b " +
+				"<span class=\"hl-keyword\">WHERE</span> c = <span class=\"hl-string\">&#39;x&#39;</span>;</code></pre>",
+		},
+		{
+			"number",
+			"<pre><code>let mut x = 42;\nprintln!(\"{}\", x);</code></pre>",
+			"<pre><code class=\"language-rust\"><span class=\"hl-keyword\">let</span> <span class=\"hl-keyword\">mut</span> x = <span class=\"hl-number\">42</span>;\n" +
+				"println!(<span class=\"hl-string\">&#34;{}&#34;</span>, x);</code></pre>",
+		},
+		{
+			"prose is left alone",
+			"<pre><code>just some &lt;text&gt;</code></pre>",
+			"<pre><code>just some &lt;text&gt;</code></pre>",
+		},
+		{
+			"code with a link is left alone",
+			"<pre><code>func <a href=\"http://x.com\">main</a>() { x := 1; return nil }</code></pre>",
+			"<pre><code>func <a href=\"http://x.com\" rel=\"nofollow\">main</a>() { x := 1; return nil }</code></pre>",
+		},
+		{
+			"escaped markup stays escaped",
+			"<pre><code>func f() { s := \"&lt;/code&gt;&lt;script&gt;alert(1)&lt;/script&gt;\"; return nil }</code></pre>",
+			"<pre><code class=\"language-go\"><span class=\"hl-keyword\">func</span> <span class=\"hl-function\">f</span>() { s := " +
+				"<span class=\"hl-string\">&#34;&lt;/code&gt;&lt;script&gt;alert(1)&lt;/script&gt;&#34;</span>; " +
+				"<span class=\"hl-keyword\">return</span> <span class=\"hl-keyword\">nil</span> }</code></pre>",
+		},
+		{
+			"code outside pre",
+			"<code>func main() { x := 1 }</code>",
+			"<code>func main() { x := 1 }</code>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// allowedOutput are the tags Text may produce, with the attributes each may have
+var allowedOutput = map[string]map[string]bool{
+	"p":    {},
+	"i":    {},
+	"pre":  {},
+	"code": {"class": true},
+	"span": {"class": true},
+	"a":    {"href": true, "rel": true, "class": true, "hx-get": true, "hx-trigger": true, "hx-swap": true},
+}
+
+// checkSafe fails the test if s has a tag or attribute Text must not produce,
+// or a link that isn't http, https or a local page
+func checkSafe(t *testing.T, in, s string) {
+	t.Helper()
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return
+		case html.CommentToken, html.DoctypeToken:
+			t.Fatalf("Text(%q) = %q has a %v", in, s, tt)
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			token := z.Token()
+			attrs, ok := allowedOutput[token.Data]
+			if !ok {
+				t.Fatalf("Text(%q) = %q has a <%s>", in, s, token.Data)
+			}
+			for _, a := range token.Attr {
+				if !attrs[a.Key] {
+					t.Fatalf("Text(%q) = %q has a <%s %s>", in, s, token.Data, a.Key)
+				}
+				if a.Key == "href" && !strings.HasPrefix(a.Val, "http://") && !strings.HasPrefix(a.Val, "https://") &&
+					!strings.HasPrefix(a.Val, "/item/") && !strings.HasPrefix(a.Val, "/user/") {
+					t.Fatalf("Text(%q) = %q links to %q", in, s, a.Val)
+				}
+			}
+		}
+	}
+}
+
+func FuzzText(f *testing.F) {
+	for _, seed := range []string{
+		`<p>one <i>two</i> <a href="https://example.com">x</a>`,
+		`<script>alert(1)</script>`,
+		`<a href="javascript:alert(1)">x</a>`,
+		`<img src=x onerror=alert(1)>`,
+		`<a href="http://e.com/&quot;onmouseover=&quot;alert(1)">x</a>`,
+		`<a href="https://news.ycombinator.com/item?id=1">x</a>`,
+		`<pre><code>func main() { x := "&lt;script&gt;" }</code></pre>`,
+		`<pre><code>SELECT '&lt;/code&gt;' FROM x</code></pre>`,
+		`<pre><code>def f(): return "&lt;a href=x&gt;"</code></pre>`,
+		`<i><pre><code>x`,
+		`<!-- x -->`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, in string) {
+		checkSafe(t, in, Text(in))
+	})
+}
@@ -0,0 +1,170 @@
+package scraper
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Form is an HTML form on an HN page
+type Form struct {
+	Action string
+	Method string
+	// Hidden holds the form's hidden fields, such as fnid, hmac and goto
+	Hidden url.Values
+	// Fields holds the other inputs, textareas and selects with their current
+	// values, such as the text of an item being edited
+	Fields url.Values
+	// Buttons holds named submit buttons, such as the yes/no of delete-confirm
+	Buttons url.Values
+}
+
+// parseForm collects a form's attributes and fields
+func parseForm(n *html.Node) Form {
+	f := Form{
+		Action:  attr(n, "action"),
+		Method:  strings.ToLower(attr(n, "method")),
+		Hidden:  make(url.Values),
+		Fields:  make(url.Values),
+		Buttons: make(url.Values),
+	}
+	if f.Method == "" {
+		f.Method = "get"
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			name := attr(n, "name")
+			switch {
+			case name == "":
+			case n.Data == "input" && strings.EqualFold(attr(n, "type"), "hidden"):
+				f.Hidden.Add(name, attr(n, "value"))
+			case n.Data == "input" && strings.EqualFold(attr(n, "type"), "submit"):
+				f.Buttons.Add(name, attr(n, "value"))
+			case n.Data == "input" && (strings.EqualFold(attr(n, "type"), "checkbox") || strings.EqualFold(attr(n, "type"), "radio")):
+				// Only checked boxes are sent, like a browser would
+				if hasAttr(n, "checked") {
+					value := attr(n, "value")
+					if value == "" {
+						value = "on"
+					}
+					f.Fields.Add(name, value)
+				}
+			case n.Data == "input":
+				f.Fields.Add(name, attr(n, "value"))
+			case n.Data == "textarea":
+				f.Fields.Add(name, textContent(n))
+			case n.Data == "select":
+				f.Fields.Add(name, selectedOption(n))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return f
+}
+
+// textContent returns the raw text inside an element, as a textarea holds it
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// selectedOption returns the value of a select's selected option, or of its first option
+func selectedOption(n *html.Node) string {
+	var first, selected *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "option" {
+			if first == nil {
+				first = n
+			}
+			if selected == nil && hasAttr(n, "selected") {
+				selected = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	if selected == nil {
+		selected = first
+	}
+	if selected == nil {
+		return ""
+	}
+	if hasAttr(selected, "value") {
+		return attr(selected, "value")
+	}
+	return textContent(selected)
+}
+
+// HasField reports whether the form has a field with the given name, hidden or not
+func (f *Form) HasField(name string) bool {
+	_, hidden := f.Hidden[name]
+	_, visible := f.Fields[name]
+	return hidden || visible
+}
+
+// Values returns a copy of the form's hidden and visible fields as they were
+// on the page, ready to have the user's input set on top
+func (f *Form) Values() url.Values {
+	values := make(url.Values, len(f.Hidden)+len(f.Fields))
+	for _, fields := range []url.Values{f.Hidden, f.Fields} {
+		for k, v := range fields {
+			values[k] = append([]string(nil), v...)
+		}
+	}
+	return values
+}
+
+// URL resolves the form's action against the page it was found on
+func (f *Form) URL(base string) (string, error) {
+	return resolve(base, f.Action)
+}
+
+// FindForm returns the first post form with all of the given fields, or nil
+func (p *Page) FindForm(fields ...string) *Form {
+	for i := range p.Forms {
+		f := &p.Forms[i]
+		if f.Method != "post" {
+			continue
+		}
+		matches := true
+		for _, field := range fields {
+			if !f.HasField(field) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return f
+		}
+	}
+	return nil
+}
+
+// resolve makes ref absolute relative to base
+func resolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,198 @@
+package scraper
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Page is the parts of a Hacker News page that web actions care about
+type Page struct {
+	Forms     []Form
+	VoteLinks []VoteLink
+	// Editable and Deletable list the items the page offers edit and delete
+	// links for, which HN only shows on the user's own recent items
+	Editable  []int
+	Deletable []int
+	// User is the logged-in username from the top bar, or "" if logged out
+	User string
+	// LogoutAuth is the auth token of the logout link, present only when logged in
+	LogoutAuth string
+	// Message is the error or notice HN printed instead of the expected page, if any
+	Message string
+	// RateLimited is set when Message says the account is acting too fast
+	RateLimited bool
+	// Items lists the IDs of the stories or comments on a list page, in order
+	Items []int
+	// More is the link to the next page of a list, or "" on the last page
+	More string
+}
+
+// LoggedIn reports whether the page was rendered for a logged-in user
+func (p *Page) LoggedIn() bool {
+	return p.User != "" || p.LogoutAuth != ""
+}
+
+// Parse reads an HN page
+func Parse(r io.Reader) (*Page, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Page{}
+	var text []string
+	// content is set below what users wrote, which may quote a banner
+	var walk func(n *html.Node, content bool)
+	walk = func(n *html.Node, content bool) {
+		switch n.Type {
+		case html.ElementNode:
+			content = content || userContent(n)
+			switch n.Data {
+			case "form":
+				p.Forms = append(p.Forms, parseForm(n))
+				// Fields belong to this form, so don't let them leak into the page text
+				return
+			case "a":
+				p.parseLink(n)
+			case "tr":
+				// Every story and comment in a list starts with a row carrying its ID
+				if hasClass(n, "athing") {
+					if id, err := strconv.Atoi(attr(n, "id")); err == nil {
+						p.Items = append(p.Items, id)
+					}
+				}
+			case "script", "style", "title":
+				// The title repeats the item's, so it is content as well
+				return
+			}
+		case html.TextNode:
+			if t := strings.TrimSpace(n.Data); t != "" && !content {
+				text = append(text, t)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, content)
+		}
+	}
+	walk(doc, false)
+
+	p.Message, p.RateLimited = findMessage(text)
+	return p, nil
+}
+
+// parseLink records the links that carry state: the current user, logout,
+// votes and the next page of a list
+func (p *Page) parseLink(n *html.Node) {
+	href := attr(n, "href")
+	switch {
+	case hasClass(n, "morelink"):
+		p.More = href
+	case attr(n, "id") == "me":
+		p.User = strings.TrimPrefix(href, "user?id=")
+	case strings.HasPrefix(href, "logout"):
+		p.LogoutAuth = queryValue(href, "auth")
+	case strings.HasPrefix(href, "vote?"):
+		if v, ok := parseVoteLink(href); ok {
+			p.VoteLinks = append(p.VoteLinks, v)
+		}
+	case strings.HasPrefix(href, "edit?"):
+		if id, err := strconv.Atoi(queryValue(href, "id")); err == nil {
+			p.Editable = append(p.Editable, id)
+		}
+	case strings.HasPrefix(href, "delete-confirm?"):
+		if id, err := strconv.Atoi(queryValue(href, "id")); err == nil {
+			p.Deletable = append(p.Deletable, id)
+		}
+	}
+}
+
+// CanEdit reports whether the page has an edit link for the item
+func (p *Page) CanEdit(id int) bool {
+	return containsID(p.Editable, id)
+}
+
+// CanDelete reports whether the page has a delete link for the item
+func (p *Page) CanDelete(id int) bool {
+	return containsID(p.Deletable, id)
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// messages are the banners HN shows in place of a page when an action fails.
+// The bool marks the ones that mean the account is being rate limited.
+var messages = []struct {
+	text        string
+	rateLimited bool
+}{
+	{"You're posting too fast", true},
+	{"You're submitting too fast", true},
+	{"not able to serve your requests this quickly", true},
+	{"Bad login", false},
+	{"Please try again", false},
+	{"That's not a valid URL", false},
+	{"Please limit titles to 80 characters", false},
+	{"Please enter a title", false},
+	{"Please don't submit duplicate", false},
+	{"You have to be logged in", false},
+	{"Unknown or expired link", false},
+	{"Validation required", false},
+}
+
+// contentClasses mark the elements holding what users wrote: the rows of
+// stories and comments, including their titles and text, and the text of
+// the item a page is about
+var contentClasses = []string{"athing", "toptext", "commtext", "comment"}
+
+// userContent reports whether the element holds what users wrote
+func userContent(n *html.Node) bool {
+	for _, class := range contentClasses {
+		if hasClass(n, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// findMessage returns the first text block outside of user content that
+// matches a known banner
+func findMessage(text []string) (string, bool) {
+	for _, t := range text {
+		for _, m := range messages {
+			if strings.Contains(t, m.text) {
+				return t, m.rateLimited
+			}
+		}
+	}
+	return "", false
+}
+
+// hasAttr reports whether the element has the named attribute
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of the named attribute, or ""
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
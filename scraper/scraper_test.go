@@ -0,0 +1,417 @@
+package scraper
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tluyben/go-hn/types"
+)
+
+// parseFixture parses a page saved from HN under testdata
+func parseFixture(t *testing.T, name string) *Page {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		user        string
+		logoutAuth  string
+		message     string
+		rateLimited bool
+		items       []int
+		more        string
+		editable    []int
+		deletable   []int
+		forms       int
+	}{
+		{fixture: "login", message: "Bad login.", forms: 2},
+		{fixture: "submit", user: "alice", logoutAuth: "4f1c0ffee", forms: 1},
+		{
+			fixture:    "item",
+			user:       "alice",
+			logoutAuth: "4f1c0ffee",
+			items:      []int{41000001, 41000002, 41000003, 41000004},
+			editable:   []int{41000003},
+			deletable:  []int{41000003},
+			forms:      2,
+		},
+		{
+			fixture:    "edit",
+			user:       "alice",
+			logoutAuth: "4f1c0ffee",
+			items:      []int{41000003},
+			editable:   []int{41000003},
+			deletable:  []int{41000003},
+			forms:      1,
+		},
+		{fixture: "delete-confirm", user: "alice", logoutAuth: "4f1c0ffee", items: []int{41000003}, forms: 1},
+		{
+			fixture:    "news",
+			user:       "alice",
+			logoutAuth: "4f1c0ffee",
+			items:      []int{41000001, 41000010, 41000020},
+			more:       "?p=2",
+			forms:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			p := parseFixture(t, tt.fixture)
+
+			if p.User != tt.user || p.LogoutAuth != tt.logoutAuth {
+				t.Errorf("user = %q with logout auth %q, want %q with %q", p.User, p.LogoutAuth, tt.user, tt.logoutAuth)
+			}
+			if p.LoggedIn() != (tt.user != "") {
+				t.Errorf("LoggedIn() = %v", p.LoggedIn())
+			}
+			if p.Message != tt.message || p.RateLimited != tt.rateLimited {
+				t.Errorf("message = %q, rate limited = %v, want %q, %v", p.Message, p.RateLimited, tt.message, tt.rateLimited)
+			}
+			if !slices.Equal(p.Items, tt.items) {
+				t.Errorf("items = %v, want %v", p.Items, tt.items)
+			}
+			if p.More != tt.more {
+				t.Errorf("more = %q, want %q", p.More, tt.more)
+			}
+			if !slices.Equal(p.Editable, tt.editable) || !slices.Equal(p.Deletable, tt.deletable) {
+				t.Errorf("editable = %v, deletable = %v, want %v, %v", p.Editable, p.Deletable, tt.editable, tt.deletable)
+			}
+			if len(p.Forms) != tt.forms {
+				t.Errorf("found %d forms, want %d", len(p.Forms), tt.forms)
+			}
+		})
+	}
+}
+
+func TestFindForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		fields  []string
+		want    *Form
+	}{
+		{
+			name:    "login",
+			fixture: "login",
+			fields:  []string{"acct", "pw"},
+			want: &Form{
+				Action:  "login",
+				Method:  "post",
+				Hidden:  url.Values{"goto": {"news"}},
+				Fields:  url.Values{"acct": {""}, "pw": {""}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			// The attributes of the form and its hidden fields are in another order
+			name:    "create account",
+			fixture: "login",
+			fields:  []string{"acct", "pw", "creating"},
+			want: &Form{
+				Action:  "login",
+				Method:  "post",
+				Hidden:  url.Values{"goto": {"news"}, "creating": {"t"}},
+				Fields:  url.Values{"acct": {""}, "pw": {""}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			name:    "submit",
+			fixture: "submit",
+			fields:  []string{"title", "url"},
+			want: &Form{
+				Action:  "/r",
+				Method:  "post",
+				Hidden:  url.Values{"fnop": {"submit-page"}, "fnid": {"Xy9fnid123"}},
+				Fields:  url.Values{"title": {""}, "url": {""}, "text": {""}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			name:    "comment",
+			fixture: "item",
+			fields:  []string{"parent", "text"},
+			want: &Form{
+				Action:  "comment",
+				Method:  "post",
+				Hidden:  url.Values{"parent": {"41000001"}, "goto": {"item?id=41000001"}, "hmac": {"9d8c7b6a"}},
+				Fields:  url.Values{"text": {""}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			name:    "edit",
+			fixture: "edit",
+			fields:  []string{"id", "text"},
+			want: &Form{
+				Action: "xedit",
+				Method: "post",
+				Hidden: url.Values{"id": {"41000003"}, "hmac": {"5e6f7a8b"}},
+				Fields: url.Values{"text": {"Validation required errors are a CI thing too.\n\n" +
+					"See https://example.com/ci & the <b>docs</b>"}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			name:    "delete",
+			fixture: "delete-confirm",
+			fields:  []string{"id", "hmac"},
+			want: &Form{
+				Action:  "/xdelete",
+				Method:  "post",
+				Hidden:  url.Values{"id": {"41000003"}, "hmac": {"1c2d3e4f"}, "goto": {"item?id=41000001"}},
+				Fields:  url.Values{},
+				Buttons: url.Values{"d": {"Yes", "No"}},
+			},
+		},
+		{
+			// The search box is a get form
+			name:    "search",
+			fixture: "news",
+			fields:  []string{"q"},
+		},
+		{
+			name:    "missing field",
+			fixture: "submit",
+			fields:  []string{"title", "parent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseFixture(t, tt.fixture).FindForm(tt.fields...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindForm(%q)\n got %+v\nwant %+v", tt.fields, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Form
+	}{
+		{
+			"attribute order",
+			`<form method="POST" action="/r"><input value="abc" name="fnid" TYPE="HIDDEN"><input name="title" value="x" type="text"></form>`,
+			Form{
+				Action:  "/r",
+				Method:  "post",
+				Hidden:  url.Values{"fnid": {"abc"}},
+				Fields:  url.Values{"title": {"x"}},
+				Buttons: url.Values{},
+			},
+		},
+		{
+			"default method",
+			`<form action="x"><input name="q"></form>`,
+			Form{Action: "x", Method: "get", Hidden: url.Values{}, Fields: url.Values{"q": {""}}, Buttons: url.Values{}},
+		},
+		{
+			"checkboxes",
+			`<form><input type="checkbox" name="a" checked><input type="checkbox" name="b" value="yes" checked><input type="checkbox" name="c"></form>`,
+			Form{Method: "get", Hidden: url.Values{}, Fields: url.Values{"a": {"on"}, "b": {"yes"}}, Buttons: url.Values{}},
+		},
+		{
+			"radios",
+			`<form><input type="radio" name="r" value="1"><input type="radio" name="r" value="2" checked></form>`,
+			Form{Method: "get", Hidden: url.Values{}, Fields: url.Values{"r": {"2"}}, Buttons: url.Values{}},
+		},
+		{
+			"selects",
+			`<form><select name="a"><option value="1">one<option value="2" selected>two</select>` +
+				`<select name="b"><option>first<option>second</select><select name="c"></select></form>`,
+			Form{Method: "get", Hidden: url.Values{}, Fields: url.Values{"a": {"2"}, "b": {"first"}, "c": {""}}, Buttons: url.Values{}},
+		},
+		{
+			"textarea",
+			`<form><textarea name="text">a &lt;i&gt;b&lt;/i&gt;
+c</textarea></form>`,
+			Form{Method: "get", Hidden: url.Values{}, Fields: url.Values{"text": {"a <i>b</i>\nc"}}, Buttons: url.Values{}},
+		},
+		{
+			"unnamed fields",
+			`<form><input type="hidden" value="x"><input type="submit" value="go"><textarea>y</textarea></form>`,
+			Form{Method: "get", Hidden: url.Values{}, Fields: url.Values{}, Buttons: url.Values{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Forms) != 1 {
+				t.Fatalf("found %d forms, want 1", len(p.Forms))
+			}
+			if got := p.Forms[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForm(%q)\n got %+v\nwant %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindVote(t *testing.T) {
+	tests := []struct {
+		fixture string
+		id      int
+		how     string
+		want    *VoteLink
+	}{
+		{"news", 41000001, "up", &VoteLink{
+			ItemID: 41000001, How: "up", Auth: "a1b2c3", Goto: "news",
+			Href: "vote?id=41000001&how=up&auth=a1b2c3&goto=news",
+		}},
+		// Already upvoted: the arrow is hidden but still there, next to the unvote link
+		{"news", 41000010, "up", &VoteLink{
+			ItemID: 41000010, How: "up", Auth: "b2c3d4", Goto: "news",
+			Href: "vote?id=41000010&how=up&auth=b2c3d4&goto=news",
+		}},
+		{"news", 41000010, "un", &VoteLink{
+			ItemID: 41000010, How: "un", Auth: "b2c3d4", Goto: "news",
+			Href: "vote?id=41000010&how=un&auth=b2c3d4&goto=news",
+		}},
+		// Jobs can't be voted on
+		{"news", 41000020, "up", nil},
+		{"item", 41000002, "down", &VoteLink{
+			ItemID: 41000002, How: "down", Auth: "d4e5f6", Goto: "item?id=41000001",
+			Href: "vote?id=41000002&how=down&auth=d4e5f6&goto=item%3Fid%3D41000001#41000002",
+		}},
+		// The user's own comment has no arrows
+		{"item", 41000003, "up", nil},
+		{"item", 41000002, "un", nil},
+		{"login", 41000001, "up", nil},
+	}
+
+	for _, tt := range tests {
+		got := parseFixture(t, tt.fixture).FindVote(tt.id, tt.how)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: FindVote(%d, %q)\n got %+v\nwant %+v", tt.fixture, tt.id, tt.how, got, tt.want)
+		}
+	}
+}
+
+func TestParseStories(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "news.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2024, 7, 20, 13, 0, 0, 0, time.UTC)
+	items, err := ParseStories(f, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []types.Item{
+		{
+			ID: 41000001, Type: "story", Rank: 1, Title: "Please try again: why our deploys kept failing",
+			URL: "https://example.com/deploys", Score: 120, By: "bob", Time: 1721469600, Descendants: 45,
+		},
+		// Text posts link to themselves, and the age has no Unix time
+		{
+			ID: 41000010, Type: "story", Rank: 2, Title: "Ask HN: You're posting too fast – how do you pace yourself?",
+			Score: 56, By: "erin", Time: 1721475000,
+		},
+		// Jobs have no score or author, and only a relative age
+		{
+			ID: 41000020, Type: "job", Rank: 3, Title: "Example (YC S21) Is Hiring Engineers",
+			URL: "https://jobs.example.org/hiring", Time: int(now.Add(-5 * time.Hour).Unix()),
+		},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d stories, want %d", len(items), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(items[i], want[i]) {
+			t.Errorf("story %d\n got %+v\nwant %+v", i, items[i], want[i])
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	now := time.Date(2024, 7, 20, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		title string
+		text  string
+		want  int
+	}{
+		{"2024-07-20T10:00:00 1721469600", "3 hours ago", 1721469600},
+		{"2024-07-20T10:00:00", "3 hours ago", 1721469600},
+		{"", "1 minute ago", int(now.Add(-time.Minute).Unix())},
+		{"", "2 days ago", int(now.Add(-48 * time.Hour).Unix())},
+		{"", "just now", int(now.Unix())},
+	}
+
+	for _, tt := range tests {
+		if got := parseAge(tt.title, tt.text, now); got != tt.want {
+			t.Errorf("parseAge(%q, %q) = %d, want %d", tt.title, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBanners(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		message     string
+		rateLimited bool
+	}{
+		{"posting too fast", `<html><body>You're posting too fast. Please slow down. Thanks.</body></html>`,
+			"You're posting too fast. Please slow down. Thanks.", true},
+		{"submitting too fast", `<body>You're submitting too fast. Please slow down. Thanks.</body>`,
+			"You're submitting too fast. Please slow down. Thanks.", true},
+		{"overloaded", `<body>Sorry, we're not able to serve your requests this quickly.</body>`,
+			"Sorry, we're not able to serve your requests this quickly.", true},
+		{"expired link", `<body>Unknown or expired link.</body>`, "Unknown or expired link.", false},
+		{"invalid url", `<table id="hnmain"><tr><td>That's not a valid URL.<br><br><form method="post" action="/r"></form></td></tr></table>`,
+			"That's not a valid URL.", false},
+		{"no banner", `<body><b>Login</b></body>`, "", false},
+
+		// What users write may quote a banner
+		{"story title", `<table><tr class="athing submission" id="1"><td class="title"><span class="titleline"><a href="x">You're posting too fast</a></span></td></tr></table>`, "", false},
+		{"page title", `<html><head><title>Please try again | Hacker News</title></head><body></body></html>`, "", false},
+		{"story text", `<table><tr><td><div class="toptext">Bad login. Please try again</div></td></tr></table>`, "", false},
+		{"comment", `<table><tr class="athing comtr" id="2"><td><div class="comment"><div class="commtext c00">You're posting too fast</div></div></td></tr></table>`, "", false},
+		{"profile text field", `<form method="post" action="/xuser"><textarea name="about">Unknown or expired link</textarea></form>`, "", false},
+		{"script", `<body><script>var m = "Bad login";</script></body>`, "", false},
+		{"banner above a quote", `<body>Please try again.<table><tr class="athing comtr" id="3"><td><div class="commtext">You're posting too fast</div></td></tr></table></body>`,
+			"Please try again.", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Message != tt.message || p.RateLimited != tt.rateLimited {
+				t.Errorf("message = %q, rate limited = %v, want %q, %v", p.Message, p.RateLimited, tt.message, tt.rateLimited)
+			}
+		})
+	}
+}
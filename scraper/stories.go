@@ -0,0 +1,188 @@
+package scraper
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tluyben/go-hn/types"
+	"golang.org/x/net/html"
+)
+
+// ParseStories reads a story list page (news, newest, ask, show, jobs) into
+// items. now is used to turn relative ages into timestamps when the page
+// doesn't carry an exact one.
+func ParseStories(r io.Reader, now time.Time) ([]types.Item, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []types.Item
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "tr" && hasClass(n, "athing") {
+			if item, ok := parseStoryRow(n, now); ok {
+				items = append(items, item)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return items, nil
+}
+
+// parseStoryRow reads the title row of a story and the subtext row after it
+func parseStoryRow(row *html.Node, now time.Time) (types.Item, bool) {
+	id, err := strconv.Atoi(attr(row, "id"))
+	if err != nil {
+		return types.Item{}, false
+	}
+	item := types.Item{ID: id, Type: "story"}
+
+	if rank := find(row, "span", "rank"); rank != nil {
+		item.Rank, _ = strconv.Atoi(strings.TrimSuffix(textOf(rank), "."))
+	}
+	if titleline := find(row, "span", "titleline"); titleline != nil {
+		if link := find(titleline, "a", ""); link != nil {
+			item.Title = textOf(link)
+			href := attr(link, "href")
+			// Ask HN and other text posts link to their own item page
+			if !strings.HasPrefix(href, "item?id=") {
+				item.URL = href
+			}
+		}
+	}
+
+	subtext := nextElement(row)
+	if subtext == nil {
+		return item, item.Title != ""
+	}
+
+	if score := find(subtext, "span", "score"); score != nil {
+		item.Score = leadingInt(textOf(score))
+	}
+	if user := find(subtext, "a", "hnuser"); user != nil {
+		item.By = textOf(user)
+	} else {
+		// Only jobs are listed without points and an author
+		item.Type = "job"
+	}
+	if age := find(subtext, "span", "age"); age != nil {
+		item.Time = parseAge(attr(age, "title"), textOf(age), now)
+	}
+
+	// The comment count is the last item link, reading "N comments" or "discuss"
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" && strings.HasPrefix(attr(n, "href"), "item?id=") {
+			if t := textOf(n); strings.Contains(t, "comment") {
+				item.Descendants = leadingInt(t)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(subtext)
+
+	return item, item.Title != ""
+}
+
+// relativeAgeRe matches ages like "3 hours ago"
+var relativeAgeRe = regexp.MustCompile(`^(\d+)\s+(minute|hour|day|month|year)s?\s+ago`)
+
+// parseAge turns an age span into a Unix timestamp. The title attribute holds
+// an ISO time, optionally followed by the Unix time; the text is relative.
+func parseAge(title, text string, now time.Time) int {
+	fields := strings.Fields(title)
+	if len(fields) > 1 {
+		if ts, err := strconv.Atoi(fields[1]); err == nil {
+			return ts
+		}
+	}
+	if len(fields) > 0 {
+		if t, err := time.Parse("2006-01-02T15:04:05", fields[0]); err == nil {
+			return int(t.Unix())
+		}
+	}
+
+	m := relativeAgeRe.FindStringSubmatch(text)
+	if m == nil {
+		return int(now.Unix())
+	}
+	n, _ := strconv.Atoi(m[1])
+	units := map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"month":  30 * 24 * time.Hour,
+		"year":   365 * 24 * time.Hour,
+	}
+	return int(now.Add(-time.Duration(n) * units[m[2]]).Unix())
+}
+
+// leadingInt returns the number a string starts with, or 0
+func leadingInt(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// find returns the first element below n with the tag and, if not empty, class
+func find(n *html.Node, tag, class string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag && (class == "" || hasClass(c, class)) {
+			return c
+		}
+		if found := find(c, tag, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// nextElement returns the next sibling element of n, or nil
+func nextElement(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// hasClass reports whether the element has the given class
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// textOf returns the element's text with whitespace, including non-breaking spaces, collapsed
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
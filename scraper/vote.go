@@ -0,0 +1,68 @@
+package scraper
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// VoteLink is an up- or downvote link, with the auth token HN requires to follow it
+type VoteLink struct {
+	ItemID int
+	How    string // "up", "down" or "un"
+	Auth   string
+	Goto   string
+	Href   string
+}
+
+// parseVoteLink reads a vote?id=...&how=...&auth=... link
+func parseVoteLink(href string) (VoteLink, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return VoteLink{}, false
+	}
+	q := u.Query()
+
+	id, err := strconv.Atoi(q.Get("id"))
+	if err != nil || q.Get("auth") == "" {
+		return VoteLink{}, false
+	}
+
+	return VoteLink{
+		ItemID: id,
+		How:    q.Get("how"),
+		Auth:   q.Get("auth"),
+		Goto:   q.Get("goto"),
+		Href:   href,
+	}, true
+}
+
+// FindVote returns the vote link for the item and direction, or nil if the
+// page has none (for example because the user already voted)
+func (p *Page) FindVote(itemID int, how string) *VoteLink {
+	for i := range p.VoteLinks {
+		v := &p.VoteLinks[i]
+		if v.ItemID == itemID && v.How == how {
+			return v
+		}
+	}
+	return nil
+}
+
+// URL resolves the link against the page it was found on
+func (v *VoteLink) URL(base string) (string, error) {
+	return resolve(base, v.Href)
+}
+
+// queryValue returns a query parameter of a relative link, or ""
+func queryValue(href, key string) string {
+	i := strings.Index(href, "?")
+	if i < 0 {
+		return ""
+	}
+	q, err := url.ParseQuery(href[i+1:])
+	if err != nil {
+		return ""
+	}
+	return q.Get(key)
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Suggestion is an autocomplete candidate taken from the index's term dictionaries
+type Suggestion struct {
+	Kind  string // "user", "domain" or "title"
+	Value string
+	Count uint64 // Number of indexed documents containing the term
+}
+
+// suggestFields maps the indexed fields used for suggestions to the kind of suggestion they produce
+var suggestFields = []struct {
+	field string
+	kind  string
+}{
+	{"by", "user"},
+	{"domain", "domain"},
+	{"title", "title"},
+}
+
+// maxTermsPerField bounds how much of each term dictionary a single lookup walks
+const maxTermsPerField = 500
+
+// Suggest returns up to limit suggestions starting with prefix, ranked by how many
+// documents contain them. It reads the index's term dictionaries directly, so
+// newly indexed items become candidates as soon as they are written. Lookups stop
+// early when ctx is done and return whatever was collected so far.
+func (i *Index) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	perField := make([][]Suggestion, 0, len(suggestFields))
+	for _, sf := range suggestFields {
+		var suggestions []Suggestion
+		seen := make(map[string]bool)
+		for _, p := range prefixVariants(sf.field, prefix) {
+			if ctx.Err() != nil {
+				break
+			}
+
+			dict, err := i.index.FieldDictPrefix(sf.field, []byte(p))
+			if err != nil {
+				return nil, err
+			}
+
+			for n := 0; n < maxTermsPerField; n++ {
+				if ctx.Err() != nil {
+					break
+				}
+				entry, err := dict.Next()
+				if err != nil || entry == nil {
+					break
+				}
+				if seen[entry.Term] {
+					continue
+				}
+				seen[entry.Term] = true
+				suggestions = append(suggestions, Suggestion{
+					Kind:  sf.kind,
+					Value: entry.Term,
+					Count: entry.Count,
+				})
+			}
+			dict.Close()
+		}
+		perField = append(perField, rankSuggestions(suggestions, limit))
+	}
+
+	return mergeSuggestions(perField, limit), nil
+}
+
+// prefixVariants returns the prefixes to look up for a field. Analyzed fields are
+// lowercased at index time; usernames are stored as typed, so try common casings.
+func prefixVariants(field, prefix string) []string {
+	lower := strings.ToLower(prefix)
+	if field != "by" {
+		return []string{lower}
+	}
+
+	variants := []string{prefix}
+	if lower != prefix {
+		variants = append(variants, lower)
+	}
+	r, size := utf8.DecodeRuneInString(lower)
+	if title := string(unicode.ToUpper(r)) + lower[size:]; title != prefix && title != lower {
+		variants = append(variants, title)
+	}
+	return variants
+}
+
+// mergeSuggestions interleaves the ranked suggestions of each field so that every
+// kind is represented, then groups the result by kind
+func mergeSuggestions(perField [][]Suggestion, limit int) []Suggestion {
+	taken := make([]int, len(perField))
+	total := 0
+	for more := true; more && total < limit; {
+		more = false
+		for f := range perField {
+			if taken[f] < len(perField[f]) && total < limit {
+				taken[f]++
+				total++
+				more = true
+			}
+		}
+	}
+
+	merged := make([]Suggestion, 0, total)
+	for f := range perField {
+		merged = append(merged, perField[f][:taken[f]]...)
+	}
+	return merged
+}
+
+// rankSuggestions orders suggestions by document count, preferring shorter terms on ties
+func rankSuggestions(suggestions []Suggestion, limit int) []Suggestion {
+	sort.SliceStable(suggestions, func(a, b int) bool {
+		if suggestions[a].Count != suggestions[b].Count {
+			return suggestions[a].Count > suggestions[b].Count
+		}
+		return len(suggestions[a].Value) < len(suggestions[b].Value)
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
@@ -0,0 +1,189 @@
+package search
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// trackingParams lists query parameters that never change the content of a page
+var trackingParams = map[string]bool{
+	"fbclid":               true,
+	"gclid":                true,
+	"dclid":                true,
+	"msclkid":              true,
+	"mc_cid":               true,
+	"mc_eid":               true,
+	"igshid":               true,
+	"ref":                  true,
+	"ref_src":              true,
+	"ref_url":              true,
+	"amp":                  true,
+	"__twitter_impression": true,
+}
+
+// redirectParams maps known redirector hosts to the query parameter holding the real target
+var redirectParams = map[string]string{
+	"l.facebook.com":  "u",
+	"lm.facebook.com": "u",
+	"google.com":      "url",
+	"out.reddit.com":  "url",
+	"slack-redir.net": "url",
+	"l.messenger.com": "u",
+	"t.umblr.com":     "z",
+	"href.li":         "",
+}
+
+// CanonicalURL normalizes a story URL so that reposts of the same article compare equal.
+// It strips tracking parameters and fragments, normalizes the scheme and host, and
+// unwraps known redirectors and AMP wrappers. It returns "" for URLs it cannot handle.
+func CanonicalURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	// Unwrap redirectors and AMP caches, guarding against redirect loops
+	for i := 0; i < 5; i++ {
+		next := unwrapURL(u)
+		if next == nil {
+			break
+		}
+		u = next
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "amp."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	if host == "" {
+		return ""
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = host + ":" + port
+	}
+
+	p := u.EscapedPath()
+	if p != "" {
+		p = path.Clean(p)
+	}
+	p = strings.TrimSuffix(p, "/amp")
+	p = strings.TrimSuffix(p, "/index.html")
+	if p == "/" || p == "." {
+		p = ""
+	}
+
+	// Drop tracking parameters and sort the rest so parameter order doesn't matter
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[key] {
+			continue
+		}
+		// AMP variants are often selected with ?output=amp or ?outputType=amp
+		if (key == "output" || key == "outputType") && query.Get(key) == "amp" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	canonical := "https://" + host + p
+	if len(parts) > 0 {
+		canonical += "?" + strings.Join(parts, "&")
+	}
+	return canonical
+}
+
+// unwrapURL returns the target of a redirector or AMP URL, or nil if u isn't one
+func unwrapURL(u *url.URL) *url.URL {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	// Google AMP viewer and the AMP cache embed the origin in the path:
+	// google.com/amp/s/example.com/a and example-com.cdn.ampproject.org/c/s/example.com/a
+	if (host == "google.com" && strings.HasPrefix(u.Path, "/amp/")) || strings.HasSuffix(host, ".cdn.ampproject.org") {
+		rest := strings.TrimPrefix(u.Path, "/amp")
+		for _, prefix := range []string{"/c/", "/v/", "/i/"} {
+			if strings.HasPrefix(rest, prefix) {
+				rest = "/" + strings.TrimPrefix(rest, prefix)
+			}
+		}
+		scheme := "http"
+		if strings.HasPrefix(rest, "/s/") {
+			scheme = "https"
+			rest = strings.TrimPrefix(rest, "/s")
+		}
+		target, err := url.Parse(scheme + ":/" + rest)
+		if err != nil || target.Host == "" {
+			return nil
+		}
+		target.RawQuery = u.RawQuery
+		return target
+	}
+
+	// Wayback Machine links wrap the original URL after the timestamp
+	if host == "web.archive.org" && strings.HasPrefix(u.Path, "/web/") {
+		rest := strings.TrimPrefix(u.Path, "/web/")
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			target, err := url.Parse(rest[idx+1:])
+			if err == nil && target.Host != "" {
+				target.RawQuery = u.RawQuery
+				return target
+			}
+		}
+		return nil
+	}
+
+	param, ok := redirectParams[host]
+	if !ok {
+		return nil
+	}
+	if host == "google.com" && u.Path != "/url" {
+		return nil
+	}
+
+	var raw string
+	if param == "" {
+		raw = u.RawQuery
+	} else {
+		raw = u.Query().Get(param)
+		if raw == "" && host == "google.com" {
+			raw = u.Query().Get("q")
+		}
+	}
+	target, err := url.Parse(raw)
+	if err != nil || target.Host == "" {
+		return nil
+	}
+	return target
+}
+
+// Domain returns the host a story links to, lowercased and without a leading "www.",
+// or "" if the URL has no host
+func Domain(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,269 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/tluyben/go-hn/types"
+)
+
+const (
+	// defaultBatchSize is the number of pending items that triggers a flush
+	defaultBatchSize = 200
+	// defaultFlushInterval is the longest an item waits in the queue
+	defaultFlushInterval = time.Second
+	// defaultMaxPending is the number of pending items at which Enqueue blocks
+	defaultMaxPending = 2000
+)
+
+// ErrIndexClosed is returned when items are queued after the index was closed
+var ErrIndexClosed = errors.New("search index is closed")
+
+// indexQueue collects items and writes them to the index in batches
+type indexQueue struct {
+	flushMu    sync.Mutex // Serializes flushes
+	mu         sync.Mutex
+	notFull    *sync.Cond
+	pending    map[int]*SearchableItem // Queued and not yet part of a batch
+	flushing   map[int]*SearchableItem // Part of the batch currently being written
+	batchSize  int
+	maxPending int
+	flushCh    chan struct{}
+	stopCh     chan struct{}
+	done       chan error
+	closed     bool
+}
+
+// startQueue initializes the queue and starts the background flusher
+func (i *Index) startQueue(batchSize int, interval time.Duration, maxPending int) {
+	q := &i.queue
+	q.notFull = sync.NewCond(&q.mu)
+	q.pending = make(map[int]*SearchableItem)
+	q.batchSize = batchSize
+	q.maxPending = maxPending
+	q.flushCh = make(chan struct{}, 1)
+	q.stopCh = make(chan struct{})
+	q.done = make(chan error, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-q.flushCh:
+			case <-q.stopCh:
+				// Drain whatever is left before shutting down
+				q.done <- i.Flush()
+				return
+			}
+			if err := i.Flush(); err != nil {
+				log.Printf("Failed to flush search index queue: %v", err)
+			}
+		}
+	}()
+}
+
+// Enqueue queues an item to be indexed in the next batch. When the queue is
+// full it blocks until a flush makes room, pushing back on the caller.
+func (i *Index) Enqueue(item *types.Item) error {
+	q := &i.queue
+	searchableItem := newSearchableItem(item)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for !q.closed && len(q.pending) >= q.maxPending {
+		// Replacing an already queued item doesn't grow the queue
+		if _, ok := q.pending[item.ID]; ok {
+			break
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrIndexClosed
+	}
+
+	q.pending[item.ID] = searchableItem
+	if len(q.pending) >= q.batchSize {
+		select {
+		case q.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Backfill queues an approximate copy of an item, such as one converted from
+// Algolia, for the index to have until the API's copy is fetched. It never
+// replaces a copy from the API, queued or written, and drops the item rather
+// than wait when the queue is full.
+func (i *Index) Backfill(item *types.Item) error {
+	q := &i.queue
+	searchableItem := newSearchableItem(item)
+	searchableItem.Approximate = true
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrIndexClosed
+	}
+	if _, ok := q.pending[item.ID]; ok {
+		return nil
+	}
+	if _, ok := q.flushing[item.ID]; ok {
+		return nil
+	}
+	if len(q.pending) >= q.maxPending {
+		return nil
+	}
+
+	q.pending[item.ID] = searchableItem
+	if len(q.pending) >= q.batchSize {
+		select {
+		case q.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the number of items waiting to be written
+func (i *Index) Pending() int {
+	q := &i.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) + len(q.flushing)
+}
+
+// Flush writes all queued items to the index in a single batch
+func (i *Index) Flush() error {
+	q := &i.queue
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	q.mu.Lock()
+	if len(q.pending) == 0 {
+		q.mu.Unlock()
+		return nil
+	}
+	q.flushing = q.pending
+	q.pending = make(map[int]*SearchableItem)
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	ids := make([]int, 0, len(q.flushing))
+	for id := range q.flushing {
+		ids = append(ids, id)
+	}
+
+	i.mu.Lock()
+	err := i.writeBatch(ids)
+	i.mu.Unlock()
+
+	q.mu.Lock()
+	if err != nil {
+		// Put the items back, unless a newer copy was queued in the meantime
+		for id, item := range q.flushing {
+			if _, ok := q.pending[id]; !ok {
+				q.pending[id] = item
+			}
+		}
+	}
+	q.flushing = nil
+	q.mu.Unlock()
+
+	return err
+}
+
+// writeBatch writes the items being flushed in one batch, leaving out
+// approximate copies of items the index has from the API. The caller must
+// hold i.mu.
+func (i *Index) writeBatch(ids []int) error {
+	exact, err := i.exactCopies(ids)
+	if err != nil {
+		return err
+	}
+
+	batch := i.index.NewBatch()
+	for _, id := range ids {
+		item := i.queue.flushing[id]
+		if item.Approximate && exact[id] {
+			continue
+		}
+		if err := batch.Index(fmt.Sprintf("%d", id), item); err != nil {
+			return err
+		}
+	}
+	return i.index.Batch(batch)
+}
+
+// exactCopies returns which of the approximate items being flushed the index
+// already has a copy from the API of. The caller must hold i.mu.
+func (i *Index) exactCopies(ids []int) (map[int]bool, error) {
+	var docIDs []string
+	for _, id := range ids {
+		if i.queue.flushing[id].Approximate {
+			docIDs = append(docIDs, fmt.Sprintf("%d", id))
+		}
+	}
+	if len(docIDs) == 0 {
+		return nil, nil
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(docIDs), len(docIDs), 0, false)
+	searchRequest.Fields = []string{"approximate"}
+	searchResult, err := i.index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	exact := make(map[int]bool, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		if approximate, _ := hit.Fields["approximate"].(bool); !approximate {
+			id, _ := strconv.Atoi(hit.ID)
+			exact[id] = true
+		}
+	}
+	return exact, nil
+}
+
+// get returns a queued item that hasn't been written yet, or nil
+func (q *indexQueue) get(id int) *SearchableItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item, ok := q.pending[id]; ok {
+		return item
+	}
+	if item, ok := q.flushing[id]; ok {
+		return item
+	}
+	return nil
+}
+
+// stopQueue stops accepting items and waits for the final flush
+func (i *Index) stopQueue() error {
+	q := &i.queue
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	close(q.stopCh)
+	return <-q.done
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// RetentionPolicy describes which items are pruned from the index
+type RetentionPolicy struct {
+	// MaxAge maps an item type to how long it is kept. Types that are missing
+	// or have a zero age are kept forever.
+	MaxAge map[string]time.Duration
+	// Keep exempts the items with these IDs regardless of age, such as the
+	// users' favorites
+	Keep map[int]bool
+	// BatchSize is the number of items deleted per index batch
+	BatchSize int
+}
+
+// Prune deletes items that have outlived the policy, in batches. After each batch
+// is committed, deleted is called with the IDs that were removed.
+func (i *Index) Prune(policy RetentionPolicy, deleted func(ids []int)) (int, error) {
+	batchSize := policy.BatchSize
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	total := 0
+	for itemType, maxAge := range policy.MaxAge {
+		if maxAge <= 0 {
+			continue
+		}
+		cutoff := float64(time.Now().Add(-maxAge).Unix())
+
+		for {
+			ids, err := i.pruneBatch(itemType, cutoff, policy.Keep, batchSize)
+			if err != nil {
+				return total, fmt.Errorf("failed to prune %s items: %v", itemType, err)
+			}
+			if len(ids) == 0 {
+				break
+			}
+			total += len(ids)
+			if deleted != nil {
+				deleted(ids)
+			}
+			if len(ids) < batchSize {
+				break
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// pruneBatch deletes up to batchSize items of itemType older than cutoff and returns their IDs
+func (i *Index) pruneBatch(itemType string, cutoff float64, keep map[int]bool, batchSize int) ([]int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	typeQuery := bleve.NewTermQuery(itemType)
+	typeQuery.SetField("type")
+	timeQuery := bleve.NewNumericRangeQuery(nil, &cutoff)
+	timeQuery.SetField("time")
+
+	query := bleve.NewBooleanQuery()
+	query.AddMust(typeQuery, timeQuery)
+	if len(keep) > 0 {
+		docIDs := make([]string, 0, len(keep))
+		for id := range keep {
+			docIDs = append(docIDs, strconv.Itoa(id))
+		}
+		query.AddMustNot(bleve.NewDocIDQuery(docIDs))
+	}
+
+	searchRequest := bleve.NewSearchRequest(query)
+	searchRequest.Size = batchSize
+
+	searchResult, err := i.index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(searchResult.Hits) == 0 {
+		return nil, nil
+	}
+
+	batch := i.index.NewBatch()
+	ids := make([]int, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		batch.Delete(hit.ID)
+		if id, err := strconv.Atoi(hit.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if err := i.index.Batch(batch); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// DiskUsage returns the number of bytes the index occupies on disk
+func (i *Index) DiskUsage() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(i.path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
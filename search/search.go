@@ -2,15 +2,21 @@ package search
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sync"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/mapping"
+	bsearch "github.com/blevesearch/bleve/v2/search"
 	"github.com/tluyben/go-hn/types"
 )
 
-// SearchableItem represents an HN item with additional fields for search and user preferences
+// SearchableItem represents an HN item with additional fields for search.
+// What users did with an item is kept in their own state, not here.
 type SearchableItem struct {
 	ID          int    `json:"id"`
 	Type        string `json:"type"`
@@ -23,18 +29,27 @@ type SearchableItem struct {
 	Title       string `json:"title,omitempty"`
 	Descendants int    `json:"descendants,omitempty"`
 	Rank        int    `json:"rank,omitempty"`
-	VoteDir     *int   `json:"vote_dir,omitempty"`
-	Favorite    bool   `json:"favorite"`
-	Hidden      bool   `json:"hidden"`
 	Flagged     bool   `json:"flagged"`
 	Summary     string `json:"summary,omitempty"`
 	Kids        []int  `json:"kids,omitempty"`
+	Dead        bool   `json:"dead,omitempty"`
+	Deleted     bool   `json:"deleted,omitempty"`
+	// CanonicalURL is the normalized URL used to find reposts of the same article
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	// Domain is the host the story links to, used for per-site listings
+	Domain string `json:"domain,omitempty"`
+	// Approximate marks a copy taken from Algolia's threads, which lack
+	// scores and dead comments and list replies by time. A copy from the API
+	// always replaces it, never the other way around.
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 // Index manages the Bleve search index
 type Index struct {
 	index bleve.Index
+	path  string
 	mu    sync.RWMutex
+	queue indexQueue
 }
 
 var (
@@ -60,29 +75,73 @@ func newIndex() (*Index, error) {
 	}
 
 	// Try to open existing index
-	index, err := bleve.Open(filepath.Join(indexPath, "hn.bleve"))
+	path := filepath.Join(indexPath, "hn.bleve")
+	index, err := bleve.Open(path)
 	if err == nil {
-		return &Index{index: index}, nil
+		// Indexes created before keyword fields existed analyze them as text,
+		// which breaks exact-match lookups on those fields
+		for _, field := range keywordFields {
+			if index.Mapping().AnalyzerNameForPath(field) != keyword.Name {
+				log.Printf("Search index field %q is not a keyword field; delete %s to rebuild the index", field, indexPath)
+			}
+		}
+		return openIndex(index, path), nil
 	}
 
 	// Create new index if it doesn't exist
-	mapping := bleve.NewIndexMapping()
-	index, err = bleve.New(filepath.Join(indexPath, "hn.bleve"), mapping)
+	index, err = bleve.New(path, buildIndexMapping())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create index: %v", err)
 	}
 
-	return &Index{index: index}, nil
+	return openIndex(index, path), nil
+}
+
+// openIndex wraps a bleve index and starts its indexing queue
+func openIndex(index bleve.Index, path string) *Index {
+	i := &Index{index: index, path: path}
+	i.startQueue(defaultBatchSize, defaultFlushInterval, defaultMaxPending)
+	return i
 }
 
-// IndexItem adds or updates an item in the search index
+// keywordFields are indexed as a single untokenized term so they can be matched exactly
+var keywordFields = []string{"canonical_url", "domain", "by"}
+
+// buildIndexMapping creates the mapping used for new indexes
+func buildIndexMapping() mapping.IndexMapping {
+	docMapping := bleve.NewDocumentMapping()
+	for _, field := range keywordFields {
+		docMapping.AddFieldMappingsAt(field, bleve.NewKeywordFieldMapping())
+	}
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = docMapping
+	return indexMapping
+}
+
+// IndexItem adds or updates an item in the search index immediately.
+// Prefer Enqueue on hot paths, which batches writes.
 func (i *Index) IndexItem(item *types.Item) error {
+	searchableItem := newSearchableItem(item)
+
+	// A queued copy of this item is older than the one being written now.
+	// Waiting out a flush in progress keeps it from writing its copy over
+	// this one, and from handing that copy to readers in the meantime.
+	i.queue.flushMu.Lock()
+	defer i.queue.flushMu.Unlock()
+	i.queue.mu.Lock()
+	delete(i.queue.pending, item.ID)
+	i.queue.mu.Unlock()
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	// Create a consistent ID format
-	id := fmt.Sprintf("%d", item.ID)
+	// Index with the same ID format
+	return i.index.Index(fmt.Sprintf("%d", item.ID), searchableItem)
+}
 
+// newSearchableItem converts an item to the document stored in the index
+func newSearchableItem(item *types.Item) *SearchableItem {
 	// Create a copy of the Kids slice to ensure we don't modify the original
 	var kids []int
 	if item.Kids != nil {
@@ -90,7 +149,7 @@ func (i *Index) IndexItem(item *types.Item) error {
 		copy(kids, item.Kids)
 	}
 
-	searchableItem := &SearchableItem{
+	return &SearchableItem{
 		ID:          item.ID,
 		Type:        item.Type,
 		By:          item.By,
@@ -102,16 +161,22 @@ func (i *Index) IndexItem(item *types.Item) error {
 		Title:       item.Title,
 		Descendants: item.Descendants,
 		Rank:        item.Rank,
-		VoteDir:     item.VoteDir,
 		Kids:        kids,
-	}
+		Dead:        item.Dead,
+		Deleted:     item.Deleted,
 
-	// Index with the same ID format
-	return i.index.Index(id, searchableItem)
+		CanonicalURL: CanonicalURL(item.URL),
+		Domain:       Domain(item.URL),
+	}
 }
 
-// GetItem retrieves an item from the search index by ID
+// GetItem retrieves an item from the search index by ID. Items that are
+// queued but not yet flushed are returned from the pending buffer.
 func (i *Index) GetItem(id int) (*SearchableItem, error) {
+	if item := i.queue.get(id); item != nil {
+		return item, nil
+	}
+
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
@@ -130,40 +195,116 @@ func (i *Index) GetItem(id int) (*SearchableItem, error) {
 		return nil, fmt.Errorf("document not found")
 	}
 
-	// Get the first hit
-	hit := searchResult.Hits[0]
+	return hitToItem(searchResult.Hits[0]), nil
+}
+
+// FindByCanonicalURL returns stories whose canonical URL matches, newest first
+func (i *Index) FindByCanonicalURL(canonical string, limit int) ([]*SearchableItem, error) {
+	if canonical == "" {
+		return nil, nil
+	}
 
-	// Convert the fields to our struct
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	query := bleve.NewTermQuery(canonical)
+	query.SetField("canonical_url")
+	searchRequest := bleve.NewSearchRequest(query)
+	searchRequest.Fields = []string{"*"}
+	searchRequest.Size = limit
+	searchRequest.SortBy([]string{"-time"})
+
+	searchResult, err := i.index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*SearchableItem, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		items = append(items, hitToItem(hit))
+	}
+	return items, nil
+}
+
+// FindByDomain returns up to size stories linking to domain or one of its
+// subdomains, newest first, along with the total number of them in the index.
+// When beforeTime is set, only stories older than the one posted at beforeTime
+// with ID beforeID are returned, so pages can continue where the last ended.
+func (i *Index) FindByDomain(domain string, beforeTime, beforeID, size int) ([]*SearchableItem, uint64, error) {
+	if domain == "" {
+		return nil, 0, nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	// Terms are matched whole, so this is the domain itself or a subdomain
+	domainQuery := bleve.NewRegexpQuery(`(.+\.)?` + regexp.QuoteMeta(domain))
+	domainQuery.SetField("domain")
+	typeQuery := bleve.NewTermQuery("story")
+	typeQuery.SetField("type")
+	query := bleve.NewConjunctionQuery(domainQuery, typeQuery)
+
+	if beforeTime > 0 {
+		t, id := float64(beforeTime), float64(beforeID)
+		inclusive, exclusive := true, false
+		olderQuery := bleve.NewNumericRangeInclusiveQuery(nil, &t, nil, &exclusive)
+		olderQuery.SetField("time")
+		sameTimeQuery := bleve.NewNumericRangeInclusiveQuery(&t, &t, &inclusive, &inclusive)
+		sameTimeQuery.SetField("time")
+		lowerIDQuery := bleve.NewNumericRangeInclusiveQuery(nil, &id, nil, &exclusive)
+		lowerIDQuery.SetField("id")
+		query.AddQuery(bleve.NewDisjunctionQuery(olderQuery, bleve.NewConjunctionQuery(sameTimeQuery, lowerIDQuery)))
+	}
+
+	searchRequest := bleve.NewSearchRequest(query)
+	searchRequest.Fields = []string{"*"}
+	searchRequest.Size = size
+	searchRequest.SortBy([]string{"-time", "-id"})
+
+	searchResult, err := i.index.Search(searchRequest)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]*SearchableItem, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		items = append(items, hitToItem(hit))
+	}
+	return items, searchResult.Total, nil
+}
+
+// hitToItem converts the stored fields of a search hit back to a SearchableItem
+func hitToItem(hit *bsearch.DocumentMatch) *SearchableItem {
 	item := &SearchableItem{
-		ID:          int(hit.Fields["id"].(float64)),
-		Type:        hit.Fields["type"].(string),
-		By:          hit.Fields["by"].(string),
-		Time:        int(hit.Fields["time"].(float64)),
-		Text:        hit.Fields["text"].(string),
-		Parent:      int(hit.Fields["parent"].(float64)),
-		URL:         hit.Fields["url"].(string),
-		Score:       int(hit.Fields["score"].(float64)),
-		Title:       hit.Fields["title"].(string),
-		Descendants: int(hit.Fields["descendants"].(float64)),
-		Rank:        int(hit.Fields["rank"].(float64)),
+		ID:           fieldInt(hit.Fields, "id"),
+		Type:         fieldString(hit.Fields, "type"),
+		By:           fieldString(hit.Fields, "by"),
+		Time:         fieldInt(hit.Fields, "time"),
+		Text:         fieldString(hit.Fields, "text"),
+		Parent:       fieldInt(hit.Fields, "parent"),
+		URL:          fieldString(hit.Fields, "url"),
+		Score:        fieldInt(hit.Fields, "score"),
+		Title:        fieldString(hit.Fields, "title"),
+		Descendants:  fieldInt(hit.Fields, "descendants"),
+		Rank:         fieldInt(hit.Fields, "rank"),
+		Summary:      fieldString(hit.Fields, "summary"),
+		CanonicalURL: fieldString(hit.Fields, "canonical_url"),
+		Domain:       fieldString(hit.Fields, "domain"),
 	}
 
 	// Handle optional fields
-	if voteDir, ok := hit.Fields["vote_dir"]; ok && voteDir != nil {
-		val := int(voteDir.(float64))
-		item.VoteDir = &val
+	if flagged, ok := hit.Fields["flagged"].(bool); ok {
+		item.Flagged = flagged
 	}
-	if favorite, ok := hit.Fields["favorite"]; ok {
-		item.Favorite = favorite.(bool)
+	if dead, ok := hit.Fields["dead"].(bool); ok {
+		item.Dead = dead
 	}
-	if hidden, ok := hit.Fields["hidden"]; ok {
-		item.Hidden = hidden.(bool)
+	if deleted, ok := hit.Fields["deleted"].(bool); ok {
+		item.Deleted = deleted
 	}
-	if flagged, ok := hit.Fields["flagged"]; ok {
-		item.Flagged = flagged.(bool)
-	}
-	if summary, ok := hit.Fields["summary"]; ok {
-		item.Summary = summary.(string)
+	if approximate, ok := hit.Fields["approximate"].(bool); ok {
+		item.Approximate = approximate
 	}
 	if kids, ok := hit.Fields["kids"]; ok && kids != nil {
 		switch v := kids.(type) {
@@ -181,10 +322,25 @@ func (i *Index) GetItem(id int) (*SearchableItem, error) {
 			}
 		case []int:
 			item.Kids = v
+		case float64:
+			// A single kid is stored as a scalar rather than an array
+			item.Kids = []int{int(v)}
 		}
 	}
 
-	return item, nil
+	return item
+}
+
+// fieldString returns a stored string field, or "" if it is missing
+func fieldString(fields map[string]interface{}, name string) string {
+	s, _ := fields[name].(string)
+	return s
+}
+
+// fieldInt returns a stored numeric field, or 0 if it is missing
+func fieldInt(fields map[string]interface{}, name string) int {
+	f, _ := fields[name].(float64)
+	return int(f)
 }
 
 // Search performs a full-text search across all indexed items
@@ -200,9 +356,14 @@ func (i *Index) Search(query string, from, size int) (*bleve.SearchResult, error
 	return i.index.Search(searchRequest)
 }
 
-// Close closes the search index
+// Close flushes any queued items and closes the search index
 func (i *Index) Close() error {
+	flushErr := i.stopQueue()
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	return i.index.Close()
+	if err := i.index.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
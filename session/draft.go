@@ -0,0 +1,81 @@
+package session
+
+import (
+	"strings"
+	"time"
+)
+
+// maxDrafts bounds how many unsent comments a session keeps. When it is
+// reached the draft saved longest ago is dropped.
+const maxDrafts = 20
+
+// Draft is the text of a comment that hasn't been posted yet
+type Draft struct {
+	Text  string    `json:"text"`
+	Saved time.Time `json:"saved"`
+}
+
+// Draft returns the unsent comment on the parent item, or "" if there is none
+func (s *Session) Draft(parentID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drafts[parentID].Text
+}
+
+// SaveDraft keeps the unsent comment on the parent item. Saving blank text
+// removes the draft.
+func (s *Session) SaveDraft(parentID int, text string) {
+	defer s.persist()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(text) == "" {
+		delete(s.drafts, parentID)
+		return
+	}
+
+	if s.drafts == nil {
+		s.drafts = make(map[int]Draft)
+	}
+	if _, ok := s.drafts[parentID]; !ok && len(s.drafts) >= maxDrafts {
+		oldest := 0
+		for id, d := range s.drafts {
+			if oldest == 0 || d.Saved.Before(s.drafts[oldest].Saved) {
+				oldest = id
+			}
+		}
+		delete(s.drafts, oldest)
+	}
+	s.drafts[parentID] = Draft{Text: text, Saved: time.Now()}
+}
+
+// DeleteDraft removes the draft on the parent item once it has been posted
+func (s *Session) DeleteDraft(parentID int) {
+	defer s.persist()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.drafts, parentID)
+}
+
+// persist has the session's store save it, so drafts survive a restart that
+// isn't a clean shutdown
+func (s *Session) persist() {
+	if s.store != nil {
+		s.store.saveSoon()
+	}
+}
+
+// copyDrafts returns a copy of the session's drafts for saving
+func (s *Session) copyDrafts() map[int]Draft {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.drafts) == 0 {
+		return nil
+	}
+	drafts := make(map[int]Draft, len(s.drafts))
+	for id, d := range s.drafts {
+		drafts[id] = d
+	}
+	return drafts
+}
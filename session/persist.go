@@ -0,0 +1,203 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tluyben/go-hn/hn"
+)
+
+// persistedSession is the on-disk form of a session
+type persistedSession struct {
+	ID       string         `json:"id"`
+	Username string         `json:"username"`
+	Cookies  []*http.Cookie `json:"cookies"`
+	Created  time.Time      `json:"created"`
+	LastSeen time.Time      `json:"last_seen"`
+	Drafts   map[int]Draft  `json:"drafts,omitempty"`
+}
+
+// RestoreFunc rebuilds a logged-in account from saved cookies
+type RestoreFunc func(username string, cookies []*http.Cookie) (*hn.Account, error)
+
+// EnablePersistence makes the store save its sessions to path, encrypted with
+// AES-GCM under key, whenever sessions are created or destroyed, shortly after
+// drafts change and on cleanup
+func (s *Store) EnablePersistence(path string, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("invalid session key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.aead = aead
+	return nil
+}
+
+// Restore loads saved sessions and rebuilds their accounts with restore.
+// Sessions whose HN login has expired are dropped; sessions that can't be
+// checked right now are kept until the next restart.
+func (s *Store) Restore(restore RestoreFunc) (int, error) {
+	if s.aead == nil {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read sessions: %v", err)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return 0, errors.New("session file is truncated")
+	}
+	plaintext, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt sessions: %v", err)
+	}
+
+	var saved []persistedSession
+	if err := json.Unmarshal(plaintext, &saved); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal sessions: %v", err)
+	}
+
+	now := time.Now()
+	restored := 0
+	var lastErr error
+	for _, ps := range saved {
+		if now.Sub(ps.LastSeen) > s.ttl {
+			continue
+		}
+
+		account, err := restore(ps.Username, ps.Cookies)
+		if errors.Is(err, hn.ErrSessionExpired) {
+			continue
+		}
+		if err != nil {
+			// HN couldn't be reached, so keep the session on disk and try
+			// again after the next restart
+			s.mu.Lock()
+			s.unverified = append(s.unverified, ps)
+			s.mu.Unlock()
+			lastErr = fmt.Errorf("failed to restore session for %s: %v", ps.Username, err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.sessions[ps.ID] = &Session{
+			ID:       ps.ID,
+			Account:  account,
+			Created:  ps.Created,
+			store:    s,
+			lastSeen: ps.LastSeen,
+			drafts:   ps.Drafts,
+		}
+		s.mu.Unlock()
+		restored++
+	}
+
+	if err := s.save(); err != nil {
+		return restored, err
+	}
+	return restored, lastErr
+}
+
+// saveDelay is how long saveSoon waits, so a burst of changes such as a
+// draft being typed is written once
+const saveDelay = 5 * time.Second
+
+// saveSoon saves the sessions after saveDelay unless a save is already
+// pending
+func (s *Store) saveSoon() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	if s.saveTimer != nil {
+		return
+	}
+	s.saveTimer = time.AfterFunc(saveDelay, func() {
+		s.saveMu.Lock()
+		s.saveTimer = nil
+		s.saveMu.Unlock()
+
+		if err := s.save(); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+	})
+}
+
+// save writes all sessions to disk if persistence is enabled
+func (s *Store) save() error {
+	s.mu.RLock()
+	if s.aead == nil {
+		s.mu.RUnlock()
+		return nil
+	}
+	saved := make([]persistedSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sess.mu.Lock()
+		lastSeen := sess.lastSeen
+		sess.mu.Unlock()
+
+		saved = append(saved, persistedSession{
+			ID:       sess.ID,
+			Username: sess.Account.Username(),
+			Cookies:  sess.Account.Cookies(),
+			Created:  sess.Created,
+			LastSeen: lastSeen,
+			Drafts:   sess.copyDrafts(),
+		})
+	}
+	for _, ps := range s.unverified {
+		if time.Since(ps.LastSeen) <= s.ttl {
+			saved = append(saved, ps)
+		}
+	}
+	aead, path := s.aead, s.path
+	s.mu.RUnlock()
+
+	plaintext, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sessions: %v", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := aead.Seal(nonce, nonce, plaintext, nil)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %v", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a corrupt file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write sessions: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write sessions: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package session
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tluyben/go-hn/hn"
+)
+
+// CookieName is the name of the cookie holding the opaque session ID
+const CookieName = "session"
+
+// Session ties a browser to the Hacker News account it acts as
+type Session struct {
+	ID      string
+	Account *hn.Account
+	Created time.Time
+
+	store    *Store
+	mu       sync.Mutex
+	lastSeen time.Time
+	drafts   map[int]Draft // Unsent comments, keyed by the item they reply to
+}
+
+// touch records activity on the session
+func (s *Session) touch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeen = now
+}
+
+// expired reports whether the session has been idle for longer than ttl
+func (s *Session) expired(now time.Time, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(s.lastSeen) > ttl
+}
+
+// Store keeps sessions server-side, keyed by session ID
+type Store struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	ttl      time.Duration
+	stopChan chan struct{}
+
+	// Set by EnablePersistence
+	path       string
+	aead       cipher.AEAD
+	unverified []persistedSession // Saved sessions that couldn't be checked at startup
+
+	saveMu    sync.Mutex
+	saveTimer *time.Timer // Pending save scheduled by saveSoon
+}
+
+// NewStore creates a session store whose sessions expire after ttl of inactivity
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		sessions: make(map[string]*Session),
+		ttl:      ttl,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Get returns the session for the request, or nil if there is no valid session
+func (s *Store) Get(r *http.Request) *Session {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	sess, ok := s.sessions[cookie.Value]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if sess.expired(now, s.ttl) {
+		s.remove(sess.ID)
+		return nil
+	}
+	sess.touch(now)
+
+	return sess
+}
+
+// Create starts a new session for account and sets its cookie. Any session the
+// request already had is destroyed, so IDs are never reused across logins.
+func (s *Store) Create(w http.ResponseWriter, r *http.Request, account *hn.Account) (*Session, error) {
+	if old := s.Get(r); old != nil {
+		s.remove(old.ID)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:       id,
+		Account:  account,
+		Created:  now,
+		store:    s,
+		lastSeen: now,
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save sessions: %v", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(s.ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return sess, nil
+}
+
+// Destroy ends the request's session, if any, and clears its cookie
+func (s *Store) Destroy(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		s.remove(cookie.Value)
+		if err := s.save(); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// remove deletes a session from the store
+func (s *Store) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// StartCleanup removes expired sessions every interval until Stop is called
+func (s *Store) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			case now := <-ticker.C:
+				s.mu.Lock()
+				for id, sess := range s.sessions {
+					if sess.expired(now, s.ttl) {
+						delete(s.sessions, id)
+					}
+				}
+				s.mu.Unlock()
+
+				// Also records recent activity, so restored sessions expire on time
+				if err := s.save(); err != nil {
+					log.Printf("Failed to save sessions: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the cleanup job and saves the sessions one last time
+func (s *Store) Stop() {
+	close(s.stopChan)
+
+	s.saveMu.Lock()
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	s.saveMu.Unlock()
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save sessions: %v", err)
+	}
+}
+
+// Usernames returns the HN users that have a live, logged-in session
+func (s *Store) Usernames() []string {
+	accounts := s.Accounts()
+	usernames := make([]string, len(accounts))
+	for i, account := range accounts {
+		usernames[i] = account.Username()
+	}
+	return usernames
+}
+
+// Accounts returns an account for each HN user that has a live, logged-in
+// session. Users logged in from several browsers are only returned once.
+func (s *Store) Accounts() []*hn.Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	var accounts []*hn.Account
+	for _, sess := range s.sessions {
+		username := sess.Account.Username()
+		if username == "" || seen[username] || sess.expired(now, s.ttl) {
+			continue
+		}
+		seen[username] = true
+		accounts = append(accounts, sess.Account)
+	}
+	return accounts
+}
+
+// newID returns a random, URL-safe session ID
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
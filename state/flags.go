@@ -0,0 +1,73 @@
+package state
+
+import (
+	"os"
+	"strings"
+)
+
+// Flags records what the user did with an item on HN, as imported from
+// their lists
+type Flags struct {
+	Upvoted  bool `json:"upvoted,omitempty"`
+	Favorite bool `json:"favorite,omitempty"`
+	Hidden   bool `json:"hidden,omitempty"`
+}
+
+// SetFlag turns one of the user's flags on an item on or off, where flag
+// picks the flag out of the item's Flags
+func (u *User) SetFlag(itemID int, flag func(f *Flags) *bool, on bool) {
+	f := u.Flags[itemID]
+	if f == nil {
+		if !on {
+			return
+		}
+		if u.Flags == nil {
+			u.Flags = make(map[int]*Flags)
+		}
+		f = &Flags{}
+		u.Flags[itemID] = f
+	}
+	*flag(f) = on
+	if *f == (Flags{}) {
+		delete(u.Flags, itemID)
+	}
+}
+
+// ItemFlags returns a copy of the user's flags, by item ID
+func (u *User) ItemFlags() map[int]Flags {
+	flags := make(map[int]Flags, len(u.Flags))
+	for id, f := range u.Flags {
+		flags[id] = *f
+	}
+	return flags
+}
+
+// Favorites returns the IDs of the items any user with a state file has
+// favorited
+func (s *Store) Favorites() (map[int]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	favorites := make(map[int]bool)
+	for _, entry := range entries {
+		username, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || !usernameRe.MatchString(username) {
+			continue
+		}
+		u, err := s.load(username)
+		if err != nil {
+			return nil, err
+		}
+		for id, f := range u.Flags {
+			if f.Favorite {
+				favorites[id] = true
+			}
+		}
+	}
+	return favorites, nil
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"sort"
+	"time"
+)
+
+// maxInboxReplies bounds how many replies an inbox keeps
+const maxInboxReplies = 200
+
+// Reply is a reply to one of the user's comments or stories
+type Reply struct {
+	ID   int    `json:"id"`
+	By   string `json:"by"`
+	Time int    `json:"time"`
+	Text string `json:"text"`
+	// ParentID is the user's item that was replied to, with its title if it
+	// is a story and its text if it is a comment
+	ParentID    int    `json:"parent_id"`
+	ParentTitle string `json:"parent_title,omitempty"`
+	ParentText  string `json:"parent_text,omitempty"`
+	Read        bool   `json:"read"`
+}
+
+// Inbox holds the replies to a user's items, newest first
+type Inbox struct {
+	Replies     []Reply   `json:"replies"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// Merge adds replies that aren't in the inbox yet as unread and returns how
+// many were added. On the very first check every reply is marked read, so
+// only replies posted after the user started using the inbox count as new.
+func (in *Inbox) Merge(replies []Reply, now time.Time) int {
+	first := in.LastChecked.IsZero()
+	in.LastChecked = now
+
+	known := make(map[int]bool, len(in.Replies))
+	for _, r := range in.Replies {
+		known[r.ID] = true
+	}
+
+	added := 0
+	for _, r := range replies {
+		if known[r.ID] {
+			continue
+		}
+		known[r.ID] = true
+		r.Read = first
+		in.Replies = append(in.Replies, r)
+		if !first {
+			added++
+		}
+	}
+
+	sort.SliceStable(in.Replies, func(i, j int) bool {
+		return in.Replies[i].Time > in.Replies[j].Time
+	})
+	if len(in.Replies) > maxInboxReplies {
+		in.Replies = in.Replies[:maxInboxReplies]
+	}
+
+	return added
+}
+
+// Unread returns the number of unread replies
+func (in *Inbox) Unread() int {
+	unread := 0
+	for _, r := range in.Replies {
+		if !r.Read {
+			unread++
+		}
+	}
+	return unread
+}
+
+// MarkAllRead marks every reply as read
+func (in *Inbox) MarkAllRead() {
+	for i := range in.Replies {
+		in.Replies[i].Read = true
+	}
+}
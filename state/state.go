@@ -0,0 +1,118 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// usernameRe matches the usernames HN allows, which also keeps them safe as file names
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// User is everything kept locally about a Hacker News user
+type User struct {
+	Username string `json:"username"`
+	Inbox    Inbox  `json:"inbox"`
+	// Sync holds the import checkpoint of each of the user's HN lists
+	Sync map[string]*SyncCheckpoint `json:"sync,omitempty"`
+	// Visits holds what the user saw of each thread they opened, by item ID
+	Visits map[int]*Visit `json:"visits,omitempty"`
+	// Flags holds the items the user upvoted, favorited or hid on HN, by ID
+	Flags map[int]*Flags `json:"flags,omitempty"`
+}
+
+// Store keeps per-user state in memory, backed by a JSON file per user
+type Store struct {
+	dir   string
+	mu    sync.Mutex
+	users map[string]*User
+}
+
+// NewStore creates a store that keeps its files in dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	return &Store{
+		dir:   dir,
+		users: make(map[string]*User),
+	}, nil
+}
+
+// View calls fn with the user's state. fn must not keep or modify it.
+func (s *Store) View(username string, fn func(u *User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.load(username)
+	if err != nil {
+		return err
+	}
+	fn(u)
+	return nil
+}
+
+// Update calls fn to modify the user's state and saves the result
+func (s *Store) Update(username string, fn func(u *User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.load(username)
+	if err != nil {
+		return err
+	}
+	fn(u)
+	return s.save(u)
+}
+
+// load returns the user's state, reading it from disk on first use
+func (s *Store) load(username string) (*User, error) {
+	if !usernameRe.MatchString(username) {
+		return nil, fmt.Errorf("invalid username: %q", username)
+	}
+	if u, ok := s.users[username]; ok {
+		return u, nil
+	}
+
+	u := &User{Username: username}
+	data, err := os.ReadFile(s.path(username))
+	if err == nil {
+		if err := json.Unmarshal(data, u); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal state for %s: %v", username, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read state for %s: %v", username, err)
+	}
+
+	s.users[username] = u
+	return u, nil
+}
+
+// save writes the user's state to disk
+func (s *Store) save(u *User) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state for %s: %v", u.Username, err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a corrupt file
+	path := s.path(u.Username)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state for %s: %v", u.Username, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state for %s: %v", u.Username, err)
+	}
+
+	return nil
+}
+
+// path returns the file holding the user's state
+func (s *Store) path(username string) string {
+	return filepath.Join(s.dir, username+".json")
+}
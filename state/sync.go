@@ -0,0 +1,26 @@
+package state
+
+import "time"
+
+// SyncCheckpoint records how far one of the user's HN lists, such as their
+// favorites, has been imported
+type SyncCheckpoint struct {
+	// Newest is the first item of the list as of the last complete import.
+	// Lists are newest first, so the next import stops when it reaches it.
+	Newest int `json:"newest,omitempty"`
+	// Next is the page an interrupted import continues from, and RunNewest
+	// the first item that import saw
+	Next      string `json:"next,omitempty"`
+	RunNewest int    `json:"run_newest,omitempty"`
+	// LastSync is when the list was last imported in full
+	LastSync time.Time `json:"last_sync"`
+	// Items lists the items the list has flagged
+	Items []int `json:"items,omitempty"`
+	// Full is set while an import walks the whole list rather than stopping
+	// at Newest, with Seen holding the items it found so far. Flags on items
+	// it no longer finds are cleared when it completes.
+	Full bool  `json:"full,omitempty"`
+	Seen []int `json:"seen,omitempty"`
+	// LastFull is when a full walk of the list last completed
+	LastFull time.Time `json:"last_full"`
+}
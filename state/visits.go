@@ -0,0 +1,111 @@
+package state
+
+import (
+	"sort"
+	"time"
+)
+
+// maxVisits bounds how many item visits are remembered per user
+const maxVisits = 200
+
+// Visit records what a user has seen of an item's thread
+type Visit struct {
+	Time time.Time `json:"time"`
+	// Prev is when the user visited before, zero on their first visit
+	Prev time.Time `json:"prev"`
+	// Seen holds the IDs of every comment the user was shown on their visits
+	Seen []int `json:"seen"`
+	// New holds the comments shown on the latest visit that weren't seen
+	// before, so replies loaded later on the same page are marked as well
+	New []int `json:"new,omitempty"`
+	// Descendants is the number of comments the item had on the latest visit
+	Descendants int `json:"descendants,omitempty"`
+}
+
+// Visit returns the user's latest visit of the item, or nil if they haven't
+// been there
+func (u *User) Visit(itemID int) *Visit {
+	return u.Visits[itemID]
+}
+
+// RecordVisit starts a new visit of the item, on which the user was shown
+// the comments with the given IDs, and returns the ones that are new since
+// their last visit. On the first visit none are.
+func (u *User) RecordVisit(itemID int, ids []int, descendants int, now time.Time) []int {
+	if u.Visits == nil {
+		u.Visits = make(map[int]*Visit)
+	}
+
+	visit := &Visit{Time: now, Descendants: descendants}
+	if prev := u.Visits[itemID]; prev != nil {
+		visit.Prev = prev.Time
+		visit.Seen = prev.Seen
+	}
+	visit.show(ids)
+	u.Visits[itemID] = visit
+
+	if len(u.Visits) > maxVisits {
+		u.forgetOldestVisits()
+	}
+
+	return visit.New
+}
+
+// RecordSeen adds comments loaded into the page of the user's latest visit
+// to what they were shown, and returns the comments that are new on that
+// visit so far
+func (u *User) RecordSeen(itemID int, ids []int) []int {
+	visit := u.Visits[itemID]
+	if visit == nil {
+		return nil
+	}
+	visit.show(ids)
+	return visit.New
+}
+
+// show adds the comments with the given IDs to those seen, and to the new
+// ones unless this is the first visit
+func (v *Visit) show(ids []int) {
+	seen := make(map[int]bool, len(v.Seen))
+	for _, id := range v.Seen {
+		seen[id] = true
+	}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		v.Seen = append(v.Seen, id)
+		if !v.Prev.IsZero() {
+			v.New = append(v.New, id)
+		}
+	}
+}
+
+// CommentCounts returns how many comments each item the user visited had
+// on their latest visit. Visits recorded before that count was kept fall
+// back to how many comments the user saw.
+func (u *User) CommentCounts() map[int]int {
+	counts := make(map[int]int, len(u.Visits))
+	for id, visit := range u.Visits {
+		counts[id] = visit.Descendants
+		if counts[id] == 0 {
+			counts[id] = len(visit.Seen)
+		}
+	}
+	return counts
+}
+
+// forgetOldestVisits drops the oldest visits until maxVisits are left
+func (u *User) forgetOldestVisits() {
+	ids := make([]int, 0, len(u.Visits))
+	for id := range u.Visits {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return u.Visits[ids[i]].Time.Before(u.Visits[ids[j]].Time)
+	})
+	for _, id := range ids[:len(ids)-maxVisits] {
+		delete(u.Visits, id)
+	}
+}
@@ -0,0 +1,89 @@
+// Collapsing comment threads. Collapsed comments are remembered in the
+// browser, so a thread stays folded when the page is reloaded.
+(() => {
+    const storageKey = 'collapsedComments';
+    const maxRemembered = 500;
+
+    const loadCollapsed = () => {
+        try {
+            return JSON.parse(localStorage.getItem(storageKey)) || [];
+        } catch (e) {
+            return [];
+        }
+    };
+
+    const saveCollapsed = (ids) => {
+        try {
+            // Keep the most recently collapsed ones when the list grows too long
+            localStorage.setItem(storageKey, JSON.stringify(ids.slice(-maxRemembered)));
+        } catch (e) {
+            // Storage may be full or disabled; collapsing still works for this page
+        }
+    };
+
+    const setCollapsed = (comment, collapsed) => {
+        comment.classList.toggle('collapsed', collapsed);
+
+        const toggle = comment.querySelector(':scope > .comment-meta > .collapse-toggle');
+        if (!toggle) return;
+
+        const hidden = parseInt(comment.dataset.descendants, 10) || 0;
+        toggle.textContent = collapsed ? (hidden > 0 ? `[+${hidden}]` : '[+]') : '[–]';
+        toggle.setAttribute('aria-expanded', collapsed ? 'false' : 'true');
+        toggle.title = collapsed ? 'Expand thread' : 'Collapse thread';
+    };
+
+    // Fold the remembered comments inside newly loaded content
+    const restore = (root) => {
+        const collapsed = new Set(loadCollapsed());
+        root.querySelectorAll('.comment[data-id]').forEach((comment) => {
+            if (collapsed.has(comment.dataset.id)) {
+                setCollapsed(comment, true);
+            }
+        });
+    };
+
+    document.addEventListener('click', (e) => {
+        const toggle = e.target.closest('.collapse-toggle');
+        if (!toggle) return;
+
+        const comment = toggle.closest('.comment');
+        const collapsed = !comment.classList.contains('collapsed');
+        setCollapsed(comment, collapsed);
+
+        const ids = loadCollapsed().filter((id) => id !== comment.dataset.id);
+        if (collapsed) {
+            ids.push(comment.dataset.id);
+        }
+        saveCollapsed(ids);
+    });
+
+    document.addEventListener('DOMContentLoaded', () => restore(document));
+    document.addEventListener('htmx:afterSwap', (e) => restore(e.detail.elt));
+})();
+
+// Jumping between the comments posted since the last visit. Comments inside
+// collapsed threads are skipped.
+(() => {
+    const isHidden = (comment) => comment.parentElement.closest('.comment.collapsed') !== null;
+
+    document.addEventListener('click', (e) => {
+        const link = e.target.closest('.next-new');
+        if (!link) return;
+        e.preventDefault();
+
+        // The summary at the top of the page jumps to the first one
+        const current = link.closest('.comment');
+        const next = Array.from(document.querySelectorAll('.comment.new')).find((comment) =>
+            comment !== current &&
+            (!current || current.compareDocumentPosition(comment) & Node.DOCUMENT_POSITION_FOLLOWING) &&
+            !isHidden(comment));
+
+        if (!next) {
+            link.textContent = 'no more new';
+            return;
+        }
+        history.replaceState(null, '', `#${next.id}`);
+        next.scrollIntoView({ behavior: 'smooth', block: 'start' });
+    });
+})();